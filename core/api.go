@@ -1 +1,81 @@
 package core
+
+// TODO: Abstract interfaces for events that will be needed,
+// TODO: so that supporting a specific protocol only requires implementing the interface.
+
+// SubjectKind is the kind of chat a message belongs to.
+type SubjectKind string
+
+const (
+	FriendSubject   SubjectKind = "Friend"
+	GroupSubject    SubjectKind = "Group"
+	TempSubject     SubjectKind = "Temp"
+	StrangerSubject SubjectKind = "Stranger"
+)
+
+// Subject identifies a chat. For temp chats, ID is the member and Group the group they're in.
+type Subject struct {
+	Kind  SubjectKind
+	ID    int
+	Group int
+}
+
+// MessageEvent is implemented by events carrying a message sent to the bot.
+type MessageEvent interface {
+	Event
+	Chain() MessageChain
+	SenderID() int
+	Subject() Subject
+}
+
+func (f FriendMessage) Chain() MessageChain { return f.MessageChain }
+func (f FriendMessage) SenderID() int       { return f.Sender.ID }
+func (f FriendMessage) Subject() Subject {
+	return Subject{Kind: FriendSubject, ID: f.Sender.ID}
+}
+
+func (g GroupMessage) Chain() MessageChain { return g.MessageChain }
+func (g GroupMessage) SenderID() int       { return g.Sender.ID }
+func (g GroupMessage) Subject() Subject {
+	return Subject{Kind: GroupSubject, ID: g.Sender.Group.ID}
+}
+
+func (t TempMessage) Chain() MessageChain { return t.MessageChain }
+func (t TempMessage) SenderID() int       { return t.Sender.ID }
+func (t TempMessage) Subject() Subject {
+	return Subject{Kind: TempSubject, ID: t.Sender.ID, Group: t.Sender.Group.ID}
+}
+
+func (s StrangerMessage) Chain() MessageChain { return s.MessageChain }
+func (s StrangerMessage) SenderID() int       { return s.Sender.ID }
+func (s StrangerMessage) Subject() Subject {
+	return Subject{Kind: StrangerSubject, ID: s.Sender.ID}
+}
+
+// RequestEvent is implemented by events the bot can accept or reject.
+type RequestEvent interface {
+	Event
+	RequestIDs() (eventID, fromID, groupID int)
+}
+
+func (n NewFriendRequestEvent) RequestIDs() (int, int, int) { return n.EventID, n.FromID, n.GroupID }
+
+func (m MemberJoinRequestEvent) RequestIDs() (int, int, int) { return m.EventID, m.FromID, m.GroupID }
+
+func (b BotInvitedJoinGroupRequestEvent) RequestIDs() (int, int, int) {
+	return b.EventID, b.FromID, b.GroupID
+}
+
+// SubjectOf returns the chat an event happened in, if it has one.
+func SubjectOf(e Event) (Subject, bool) {
+	switch e := e.(type) {
+	case MessageEvent:
+		return e.Subject(), true
+	case *GroupRecallEvent:
+		return Subject{Kind: GroupSubject, ID: e.Group.ID}, true
+	case *FriendRecallEvent:
+		return Subject{Kind: FriendSubject, ID: e.AuthorID}, true
+	default:
+		return Subject{}, false
+	}
+}
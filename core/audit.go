@@ -0,0 +1,322 @@
+package core
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"golang.org/x/xerrors"
+	"gopkg.in/natefinch/lumberjack.v2"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AuditConfig holds the settings of the audit log.
+type AuditConfig struct {
+	Enable     bool   `yaml:"enable"`      // Record side-effecting actions
+	File       string `yaml:"file"`        // JSONL file the actions are appended to
+	MaxSizeMB  int    `yaml:"max_size_mb"` // Max megabytes of the file before it is rotated
+	MaxBackups int    `yaml:"max_backups"` // Max rotated files kept, 0 keeps all
+}
+
+// DefaultAuditConfig provides a basic default AuditConfig.
+func DefaultAuditConfig() AuditConfig {
+	return AuditConfig{
+		Enable:     false,
+		File:       "data/audit.jsonl",
+		MaxSizeMB:  10,
+		MaxBackups: 5,
+	}
+}
+
+// audited are the mirai endpoints with side effects.
+var audited = map[string]bool{
+	"/sendFriendMessage":                    true,
+	"/sendGroupMessage":                     true,
+	"/sendTempMessage":                      true,
+	"/recall":                               true,
+	"/mute":                                 true,
+	"/unmute":                               true,
+	"/muteAll":                              true,
+	"/unmuteAll":                            true,
+	"/kick":                                 true,
+	"/quit":                                 true,
+	"/setEssence":                           true,
+	"/groupConfig":                          true,
+	"/memberInfo":                           true,
+	"/memberAdmin":                          true,
+	"/resp/newFriendRequestEvent":           true,
+	"/resp/memberJoinRequestEvent":          true,
+	"/resp/botInvitedJoinGroupRequestEvent": true,
+}
+
+// Audit sources, see AuditEntry.Source.
+const (
+	AuditFromEvent    = "event"
+	AuditFromJob      = "job"
+	AuditFromInternal = "internal"
+)
+
+// AuditEntry records an action of the bot and what triggered it.
+type AuditEntry struct {
+	Time    time.Time              `json:"time"`
+	Action  string                 `json:"action"` // Mirai endpoint, or bot setting changed
+	Params  map[string]interface{} `json:"params,omitempty"`
+	Code    int                    `json:"code"` // Mirai status code, -1 if the request failed
+	Error   string                 `json:"error,omitempty"`
+	Source  string                 `json:"source"` // event, job, internal, or api:<token> for the admin API
+	Event   string                 `json:"event,omitempty"`
+	UserID  int                    `json:"user_id,omitempty"`  // Sender of the triggering message or request
+	GroupID int                    `json:"group_id,omitempty"` // Group the triggering event happened in
+	Plugin  string                 `json:"plugin,omitempty"`
+	Command string                 `json:"command,omitempty"`
+	Job     string                 `json:"job,omitempty"`
+}
+
+// AuditFilter selects audit entries. Zero fields match everything.
+type AuditFilter struct {
+	Action  string
+	UserID  int
+	GroupID int
+}
+
+func (f AuditFilter) match(e *AuditEntry) bool {
+	return (f.Action == "" || strings.TrimPrefix(e.Action, "/") == strings.TrimPrefix(f.Action, "/")) &&
+		(f.UserID == 0 || e.UserID == f.UserID) &&
+		(f.GroupID == 0 || e.GroupID == f.GroupID || e.Params["target"] == float64(f.GroupID))
+}
+
+// AuditLog appends the side-effecting actions of the bot to a JSONL file, rotated by size.
+// Message bodies are not recorded. A nil *AuditLog records nothing.
+type AuditLog struct {
+	path string
+
+	mu   sync.Mutex
+	file *lumberjack.Logger
+}
+
+// NewAuditLog creates an AuditLog writing to cfg.File, opened on first write.
+func NewAuditLog(cfg AuditConfig) *AuditLog {
+	return &AuditLog{
+		path: cfg.File,
+		file: &lumberjack.Logger{
+			Filename:   cfg.File,
+			MaxSize:    cfg.MaxSizeMB,
+			MaxBackups: cfg.MaxBackups,
+		},
+	}
+}
+
+// auditActorKey is the context key of the actor of admin API requests.
+type auditActorKey struct{}
+
+// withAuditActor marks ctx as coming from actor, e.g. an admin API token.
+func withAuditActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, auditActorKey{}, actor)
+}
+
+// Record appends an action done within ctx to the log, along with what triggered it.
+func (a *AuditLog) Record(ctx context.Context, action string, params map[string]interface{}, err error) {
+	if a == nil {
+		return
+	}
+	e := AuditEntry{Time: time.Now(), Action: action, Params: redact(params), Source: AuditFromInternal}
+	var apiErr *APIError
+	switch {
+	case xerrors.As(err, &apiErr):
+		e.Code, e.Error = apiErr.Code, apiErr.Msg
+	case err != nil:
+		e.Code, e.Error = -1, err.Error()
+	}
+	auditTrigger(ctx, &e)
+
+	if err := a.write(&e); err != nil {
+		Log().Error("Failed to write audit entry for %s: %s", action, err)
+	}
+}
+
+// redact returns a copy of params with message chains replaced by the types of their components.
+func redact(params map[string]interface{}) map[string]interface{} {
+	chain, ok := params["messageChain"]
+	if !ok {
+		return params
+	}
+	cp := make(map[string]interface{}, len(params))
+	for k, v := range params {
+		cp[k] = v
+	}
+	var types []string
+	if chain, ok := chain.(MessageChain); ok {
+		for _, m := range chain {
+			types = append(types, m.ComponentType())
+		}
+	}
+	cp["messageChain"] = types
+	return cp
+}
+
+// auditTrigger fills in what triggered an action from its context.
+func auditTrigger(ctx context.Context, e *AuditEntry) {
+	switch x := ctx.(type) {
+	case *Context:
+		e.Source, e.Plugin = AuditFromEvent, x.timing.plugin
+		if x.Event != nil {
+			e.Event = x.Event.EventType()
+		}
+		e.Command, _ = x.Value(commandKey).(string)
+		switch ev := x.Event.(type) {
+		case MessageEvent:
+			e.UserID = ev.SenderID()
+		case RequestEvent:
+			_, e.UserID, e.GroupID = ev.RequestIDs()
+		}
+		if s, ok := SubjectOf(x.Event); ok {
+			switch s.Kind {
+			case GroupSubject:
+				e.GroupID = s.ID
+			case TempSubject:
+				e.GroupID = s.Group
+			}
+		}
+	case *JobContext:
+		e.Source, e.Job = AuditFromJob, x.Name
+	default:
+		if ctx != nil {
+			if actor, ok := ctx.Value(auditActorKey{}).(string); ok {
+				e.Source = actor
+			}
+		}
+	}
+}
+
+// write appends e to the file.
+func (a *AuditLog) write(e *AuditEntry) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	_, err = a.file.Write(append(data, '\n'))
+	return err
+}
+
+// Query returns the last limit entries matching f, oldest first.
+// Only the current file is read, so a query scans at most AuditConfig.MaxSizeMB.
+func (a *AuditLog) Query(f AuditFilter, limit int) ([]AuditEntry, error) {
+	file, err := os.Open(a.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, xerrors.Errorf("open audit log: %w", err)
+	}
+	defer file.Close()
+
+	var entries []AuditEntry
+	sc := bufio.NewScanner(file)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for sc.Scan() {
+		var e AuditEntry
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil || !f.match(&e) {
+			continue
+		}
+		entries = append(entries, e)
+		if limit > 0 && len(entries) > limit {
+			entries = entries[1:]
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, xerrors.Errorf("read audit log: %w", err)
+	}
+	return entries, nil
+}
+
+// Close closes the file.
+func (a *AuditLog) Close() error {
+	if a == nil {
+		return nil
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.file.Close()
+}
+
+// String formats an entry on one line for chat.
+func (e AuditEntry) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s %s", e.Time.Format("01-02 15:04:05"), e.Action)
+	if len(e.Params) > 0 {
+		params, _ := json.Marshal(e.Params)
+		fmt.Fprintf(&sb, " %s", params)
+	}
+	if e.Code != 0 {
+		fmt.Fprintf(&sb, " failed (%d)", e.Code)
+	}
+	fmt.Fprintf(&sb, " by %s", e.Source)
+	if e.UserID != 0 {
+		fmt.Fprintf(&sb, " %d", e.UserID)
+	}
+	if e.Command != "" {
+		fmt.Fprintf(&sb, " cmd %s", e.Command)
+	}
+	if e.Plugin != "" {
+		fmt.Fprintf(&sb, " plugin %s", e.Plugin)
+	}
+	if e.Job != "" {
+		fmt.Fprintf(&sb, " job %s", e.Job)
+	}
+	return sb.String()
+}
+
+// auditCommand lets admins query the audit log.
+func auditCommand() *Command {
+	return &Command{
+		Name:  "audit",
+		Usage: "show recent bot actions: audit [count] [user <id>|group <id>|action <name>]",
+		Admin: true,
+		Handler: func(c *Context, args []string) {
+			if c.Audit == nil {
+				c.SendText("The audit log is disabled.")
+				return
+			}
+
+			limit, f := 10, AuditFilter{}
+			if len(args) > 0 {
+				if n, err := strconv.Atoi(args[0]); err == nil && n > 0 {
+					limit, args = n, args[1:]
+				}
+			}
+			for ; len(args) >= 2; args = args[2:] {
+				switch args[0] {
+				case "user":
+					f.UserID, _ = strconv.Atoi(args[1])
+				case "group":
+					f.GroupID, _ = strconv.Atoi(args[1])
+				case "action":
+					f.Action = args[1]
+				}
+			}
+
+			entries, err := c.Audit.Query(f, limit)
+			if err != nil {
+				c.Log().Error("Failed to query audit log: %s", err)
+				c.SendText("Failed to query the audit log.")
+				return
+			}
+			if len(entries) == 0 {
+				c.SendText("No matching actions.")
+				return
+			}
+			lines := make([]string, len(entries))
+			for i, e := range entries {
+				lines[i] = e.String()
+			}
+			c.SendText("%s", strings.Join(lines, "\n"))
+		},
+	}
+}
@@ -0,0 +1,165 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"golang.org/x/xerrors"
+	"sync"
+	"time"
+)
+
+var (
+	ErrAwaitTimeout = errors.New("await timed out")
+	ErrBotStopped   = errors.New("bot stopped")
+)
+
+// Filter selects the message an awaiting handler is interested in.
+type Filter func(e MessageEvent) bool
+
+// waiterKey is the sender and chat a waiter listens to.
+type waiterKey struct {
+	Subject Subject
+	Sender  int
+}
+
+type waiter struct {
+	filter Filter
+	ch     chan MessageEvent
+}
+
+// waiters is the registry of handlers waiting for a message.
+type waiters struct {
+	mu sync.Mutex
+	m  map[waiterKey][]*waiter
+}
+
+func newWaiters() *waiters {
+	return &waiters{m: make(map[waiterKey][]*waiter)}
+}
+
+func (ws *waiters) add(key waiterKey, w *waiter) {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	ws.m[key] = append(ws.m[key], w)
+}
+
+// remove unregisters w and reports whether it was still registered, i.e. no message was delivered to it.
+func (ws *waiters) remove(key waiterKey, w *waiter) bool {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	list := ws.m[key]
+	for i, other := range list {
+		if other == w {
+			ws.set(key, append(list[:i], list[i+1:]...))
+			return true
+		}
+	}
+	return false
+}
+
+// set replaces the waiters of key. The caller must hold ws.mu.
+func (ws *waiters) set(key waiterKey, list []*waiter) {
+	if len(list) == 0 {
+		delete(ws.m, key)
+	} else {
+		ws.m[key] = list
+	}
+}
+
+// match returns the index of the first waiter accepting e, or -1. The caller must hold ws.mu.
+func (ws *waiters) match(key waiterKey, e MessageEvent) int {
+	for i, w := range ws.m[key] {
+		if w.filter == nil || w.filter(e) {
+			return i
+		}
+	}
+	return -1
+}
+
+// accepts reports whether a waiter currently accepts e.
+func (ws *waiters) accepts(e MessageEvent) bool {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	return ws.match(waiterKey{Subject: e.Subject(), Sender: e.SenderID()}, e) >= 0
+}
+
+// deliver hands e to the first waiter accepting it and reports whether one did.
+func (ws *waiters) deliver(e MessageEvent) bool {
+	key := waiterKey{Subject: e.Subject(), Sender: e.SenderID()}
+
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	i := ws.match(key, e)
+	if i < 0 {
+		return false
+	}
+	list := ws.m[key]
+	w := list[i]
+	ws.set(key, append(list[:i], list[i+1:]...))
+	w.ch <- e // buffered and delivered once, never blocks
+	return true
+}
+
+// Await waits for the next message from the sender of the current message, in the same chat, accepted by filter.
+// The awaited message is consumed and not dispatched to other handlers.
+// A nil filter accepts any message. Await returns ErrAwaitTimeout after timeout,
+// the error of ctx when it's done, or ErrBotStopped when the bot shuts down. A nil ctx means c itself.
+//
+// Awaited messages skip the queue of their chat, so Await can be called right from a handler.
+// It still holds up the following events of the chat until it returns, so long waits are better started with Go.
+func (c *Context) Await(ctx context.Context, filter Filter, timeout time.Duration) (MessageEvent, error) {
+	e, ok := c.Event.(MessageEvent)
+	if !ok {
+		return nil, xerrors.Errorf("%s is not a message event", c.Event.EventType())
+	}
+	if ctx == nil {
+		ctx = c
+	}
+
+	key := waiterKey{Subject: e.Subject(), Sender: e.SenderID()}
+	w := &waiter{filter: filter, ch: make(chan MessageEvent, 1)}
+	c.waiters.add(key, w)
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	var err error
+	select {
+	case next := <-w.ch:
+		return next, nil
+	case <-timer.C:
+		err = ErrAwaitTimeout
+	case <-ctx.Done():
+		err = ctx.Err()
+	case <-c.stopped:
+		err = ErrBotStopped
+	}
+	if !c.waiters.remove(key, w) {
+		// A message was delivered while giving up, and Resume already consumed it.
+		return <-w.ch, nil
+	}
+	return nil, err
+}
+
+// Go runs fn in a new goroutine with a copy of the Context that outlives the dispatch of the event,
+// e.g. to Await further messages. The Bot waits for these goroutines when it stops.
+// fn gets a Copy of the Context, so Next and Abort do nothing.
+func (c *Context) Go(fn func(c *Context)) {
+	cp := c.Copy()
+	c.routines.Add(1)
+	go func() {
+		defer c.routines.Done()
+		fn(cp)
+	}()
+}
+
+// Resume hands messages to the handlers awaiting them, see Context.Await.
+func Resume() Middleware {
+	return func(c *Context) {
+		if e, ok := c.Event.(MessageEvent); ok && c.waiters.deliver(e) {
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
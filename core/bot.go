@@ -1,18 +1,45 @@
 package core
 
 import (
+	"context"
 	"github.com/gin-contrib/pprof"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"sync"
 )
 
 // Bot represents a QQ bot.
 type Bot struct {
 	*Config
 	*Server
-
-	Middlewares []Middleware
-
-	withConfig bool
-	withPProf  bool
+	*Client
+
+	Contacts     *Contacts
+	Messages     *MessageStore
+	Storage      *Storage
+	Features     *Features
+	Scheduler    *Scheduler
+	Dispatcher   *Dispatcher
+	Deduplicator *Deduplicator
+	Metrics      *Metrics
+	Health       *Health
+	Audit        *AuditLog
+	Middlewares  []Middleware
+
+	plugins  plugins
+	commands map[string]*Command
+	requests *pendingRequests
+	waiters  *waiters
+	panics   panicReporter
+	routines sync.WaitGroup
+	stopped  chan struct{} // closed when shutdown starts
+	stopOnce sync.Once
+	ctx      context.Context // root of all event and job contexts, cancelled on shutdown
+	cancel   context.CancelFunc
+
+	withConfig  bool
+	withPProf   bool
+	withMetrics bool
 }
 
 // Option defines a function type for Bot options.
@@ -23,19 +50,56 @@ func New(options ...Option) *Bot {
 	b := &Bot{
 		Config:      DefaultConfig(),
 		Server:      DefaultServer(),
-		Middlewares: []Middleware{Rx()},
+		Client:      DefaultClient(),
+		Contacts:    NewContacts(),
+		Middlewares: []Middleware{Recovery(), Rx(), Dedup(), TrackState(), ContactSync(), Remember(), AntiRecall(), Resume(), RequestPolicy(), Commands()},
+		waiters:     newWaiters(),
+		stopped:     make(chan struct{}),
 		withConfig:  false,
 		withPProf:   false,
 	}
+	b.Command(helpCommand())
+	b.Command(requestCommands()...)
+	b.Command(pluginsCommand())
+	b.Command(featureCommands()...)
+	b.Command(statusCommand())
+	b.Command(logLevelCommand())
+	b.Command(auditCommand())
 
 	RegisterLogger(b.Config.Log)
 	//RegisterEvent()
 	//RegisterMsgElem()
 
+	b.ctx, b.cancel = context.WithCancel(context.Background())
+
 	// apply any provided options
 	for _, option := range options {
 		option(b)
 	}
+	Log().Update(b.Config.Log)
+	if b.withMetrics {
+		b.Metrics = NewMetrics(b)
+		b.GET("/metrics", b.Metrics.Handler())
+	}
+	b.Server.bot = b
+	b.Client.contacts = b.Contacts
+	b.Client.metrics = b.Metrics
+	if b.Config.Audit.Enable {
+		b.Audit = NewAuditLog(b.Config.Audit)
+	}
+	b.Client.audit = b.Audit
+	b.requests = newPendingRequests(b.Config.Request)
+	b.Storage = NewStorage(b.Config.Storage)
+	b.Features = NewFeatures(b.Storage)
+	b.Scheduler = NewScheduler(b)
+	b.Dispatcher = NewDispatcher(b, b.Config.Dispatch)
+	b.Health = NewHealth(b)
+	if b.Config.Dedup.Enable {
+		b.Deduplicator = NewDeduplicator(b.Config.Dedup)
+	}
+	if b.Config.MessageStore.Enable {
+		b.Messages = NewMessageStore(b.Config.MessageStore)
+	}
 
 	if !b.withConfig {
 		Log().Warn("Using the default configuration, some settings may not meet your expectations!")
@@ -62,6 +126,7 @@ func WithConfig(cfg *Config) Option {
 		b.withConfig = true
 		b.Config = cfg
 		b.Server = NewServer(cfg.Server)
+		b.Client = NewClient(cfg.Server)
 	}
 }
 
@@ -77,24 +142,78 @@ func (b *Bot) Use(m Middleware) {
 	b.Middlewares = append(b.Middlewares, m)
 }
 
-// Run starts the Bot.Server.
-func (b *Bot) Run() error {
+// Start starts plugins and event processing and registers the HTTP routes without serving them.
+// Run calls it; call it directly to drive the bot through Server.Engine, e.g. in tests, then Close.
+func (b *Bot) Start() {
+	b.startPlugins()
+	b.Scheduler.Start()
+	b.setupSweep()
+	b.Dispatcher.Start()
 	b.setupHook()
+	b.setupHealth()
+	b.setupAPI()
+
+	if err := b.Contacts.Load(b.Client.WithContext(b.ctx)); err != nil {
+		Log().Warn("Failed to load contacts, the cache will be filled by events: %s", err)
+	}
+}
+
+// Close gracefully shuts down a bot started with Start.
+func (b *Bot) Close() error {
+	b.Stop()
+	return b.shutdown()
+}
+
+// Run starts the Bot and serves HTTP until it is stopped by a signal or Stop.
+func (b *Bot) Run() error {
+	b.Start()
 
 	Log().Info("Bot is listening for events on http://%s/hook.", b.httpServer.Addr)
 	Log().Info("Bot will report behavior to %s.", b.Config.Server.Post)
 	if b.withPProf {
 		Log().Info("Bot has enabled PProf at http://%s/debug", b.httpServer.Addr)
 	}
+	if b.Config.API.Enable {
+		Log().Info("Bot serves the admin API at http://%s/api/v1", b.httpServer.Addr)
+	}
+	if b.withMetrics {
+		Log().Info("Bot serves metrics at http://%s/metrics", b.httpServer.Addr)
+	}
 
-	if err := b.Server.Run(); err != nil {
+	go b.handleSignals()
+	b.Server.Start()
+	<-b.stopped
+
+	if err := b.shutdown(); err != nil {
 		return err
 	}
-
 	Log().Info("Good Dream.")
 	return nil
 }
 
+// setupHook registers the webhook mirai reports events to.
+// Events are acknowledged as soon as they are queued to the Dispatcher.
 func (b *Bot) setupHook() {
-	b.Server.POST("/hook", b.Middlewares...)
+	b.Engine.POST("/hook", func(gc *gin.Context) {
+		raw, err := gc.GetRawData()
+		if err != nil {
+			Log().Error("Failed to get raw JSON data: %s", err)
+			gc.Status(http.StatusBadRequest)
+			return
+		}
+		e, err := ParseEvent(raw)
+		if err != nil {
+			b.Metrics.observeParseFailure()
+			Log().Error("Failed to parse event data: %s", err)
+			gc.Status(http.StatusBadRequest)
+			return
+		}
+		b.Metrics.observeEvent(e)
+		if err := b.Dispatcher.Enqueue(b.NewContext(e, raw)); err != nil {
+			Log().Warn("Dropped %s: %s", e.EventType(), err)
+			gc.Status(http.StatusServiceUnavailable)
+			return
+		}
+		gc.Status(http.StatusOK)
+	})
 }
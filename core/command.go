@@ -0,0 +1,119 @@
+package core
+
+import (
+	"sort"
+	"strings"
+)
+
+// Command is a text command such as "/help", handled when a message starts with CommandConfig.Prefix.
+type Command struct {
+	Name    string                          // Name typed after the prefix
+	Usage   string                          // One-line help text
+	Admin   bool                            // Restricted to Config.Admin
+	Handler func(c *Context, args []string) // Called with the whitespace-separated arguments
+
+	plugin string // Plugin registering the command, if any
+}
+
+// CommandConfig holds command settings.
+type CommandConfig struct {
+	Prefix string `yaml:"prefix"` // Prefix that marks a message as a command
+}
+
+// DefaultCommandConfig provides a basic default CommandConfig.
+func DefaultCommandConfig() CommandConfig {
+	return CommandConfig{
+		Prefix: "/",
+	}
+}
+
+// Command registers commands, replacing any with the same name.
+func (b *Bot) Command(cmds ...*Command) {
+	if b.commands == nil {
+		b.commands = make(map[string]*Command)
+	}
+	for _, cmd := range cmds {
+		b.commands[cmd.Name] = cmd
+	}
+}
+
+// commandKey is the Context key of the name of the running command.
+const commandKey = "koharu.command"
+
+// Commands runs the command a message event starts with, if any.
+// Other events and plain messages are passed down the chain.
+func Commands() Middleware {
+	return func(c *Context) {
+		e, ok := c.Event.(MessageEvent)
+		prefix := c.Config.Command.Prefix
+		if !ok || prefix == "" {
+			c.Next()
+			return
+		}
+
+		text := strings.TrimSpace(e.Chain().PlainText())
+		if !strings.HasPrefix(text, prefix) {
+			c.Next()
+			return
+		}
+		fields := strings.Fields(strings.TrimPrefix(text, prefix))
+		if len(fields) == 0 {
+			c.Next()
+			return
+		}
+
+		cmd, ok := c.commands[fields[0]]
+		if !ok || (cmd.plugin != "" && !c.FeatureEnabled(cmd.plugin)) {
+			c.Next()
+			return
+		}
+		if cmd.Admin && !c.IsAdmin(e.SenderID()) {
+			c.Log().Warn("%d is not allowed to run %s%s", e.SenderID(), prefix, cmd.Name)
+			c.Abort()
+			return
+		}
+
+		c.SetValue(commandKey, cmd.Name)
+		c.timing.plugin = cmd.plugin
+		cmd.Handler(c, fields[1:])
+		c.Abort()
+	}
+}
+
+// IsAdmin reports whether id is a bot admin.
+func (b *Bot) IsAdmin(id int) bool {
+	for _, admin := range b.Config.Admin {
+		if admin == id {
+			return true
+		}
+	}
+	return false
+}
+
+// helpCommand lists the commands available to the sender.
+func helpCommand() *Command {
+	return &Command{
+		Name:  "help",
+		Usage: "list available commands",
+		Handler: func(c *Context, args []string) {
+			e := c.Event.(MessageEvent)
+			isAdmin := c.IsAdmin(e.SenderID())
+
+			names := make([]string, 0, len(c.commands))
+			for name, cmd := range c.commands {
+				if !cmd.Admin || isAdmin {
+					names = append(names, name)
+				}
+			}
+			sort.Strings(names)
+
+			var sb strings.Builder
+			for _, name := range names {
+				sb.WriteString(c.Config.Command.Prefix + name + " - " + c.commands[name].Usage + "\n")
+			}
+			if _, err := c.SendText("%s", strings.TrimSuffix(sb.String(), "\n")); err != nil {
+				c.Log().Error("Failed to send help: %s", err)
+			}
+		},
+	}
+}
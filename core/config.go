@@ -6,6 +6,17 @@ type Config struct {
 	Log       LoggerConfig    `yaml:"log"`       // Logger settings
 	Server    ServerConfig    `yaml:"server"`    // Server settings
 	Whitelist WhitelistConfig `yaml:"whitelist"` // Message whitelist
+	Command   CommandConfig   `yaml:"command"`   // Command settings
+	Request   RequestConfig   `yaml:"request"`   // Friend, join and invite request policy
+
+	MessageStore MessageStoreConfig `yaml:"message_store"` // Recent message store
+	Storage      StorageConfig      `yaml:"storage"`       // Persistent storage
+	Recovery     RecoveryConfig     `yaml:"recovery"`      // Panic recovery
+	Dispatch     DispatchConfig     `yaml:"dispatch"`      // Event worker pool
+	Dedup        DedupConfig        `yaml:"dedup"`         // Duplicate event suppression
+	Health       HealthConfig       `yaml:"health"`        // Health checks
+	API          APIConfig          `yaml:"api"`           // Admin REST API
+	Audit        AuditConfig        `yaml:"audit"`         // Audit log of bot actions
 }
 
 // DefaultConfig creates a new Config with default settings.
@@ -15,24 +26,39 @@ func DefaultConfig() *Config {
 		Log:       DefaultLoggerConfig(),
 		Server:    DefaultServerConfig(),
 		Whitelist: DefaultWhitelistConfig(),
+		Command:   DefaultCommandConfig(),
+		Request:   DefaultRequestConfig(),
+
+		MessageStore: DefaultMessageStoreConfig(),
+		Storage:      DefaultStorageConfig(),
+		Recovery:     DefaultRecoveryConfig(),
+		Dispatch:     DefaultDispatchConfig(),
+		Dedup:        DefaultDedupConfig(),
+		Health:       DefaultHealthConfig(),
+		API:          DefaultAPIConfig(),
+		Audit:        DefaultAuditConfig(),
 	}
 }
 
 // ServerConfig holds server communication behavior.
 type ServerConfig struct {
-	Address string `yaml:"address"` // HTTP listener address
-	Secret  string `yaml:"secret"`  // Authentication key
-	Post    string `yaml:"post"`    // Reverse POST address
-	Timeout int    `yaml:"timeout"` // Reverse HTTP timeout in seconds
+	Address  string `yaml:"address"`  // HTTP listener address
+	Secret   string `yaml:"secret"`   // Authentication key
+	Post     string `yaml:"post"`     // Reverse POST address
+	Timeout  int    `yaml:"timeout"`  // Reverse HTTP timeout in seconds
+	QQ       int    `yaml:"qq"`       // Bot account to bind the session to
+	Shutdown int    `yaml:"shutdown"` // Graceful shutdown timeout in seconds
 }
 
 // DefaultServerConfig provides a basic default ServerCfg.
 func DefaultServerConfig() ServerConfig {
 	return ServerConfig{
-		Address: "127.0.0.1:5701",
-		Secret:  "",
-		Post:    "http://127.0.0.1:5700",
-		Timeout: 5,
+		Address:  "127.0.0.1:5701",
+		Secret:   "",
+		Post:     "http://127.0.0.1:5700",
+		Timeout:  5,
+		QQ:       0,
+		Shutdown: 10,
 	}
 }
 
@@ -0,0 +1,275 @@
+package core
+
+import (
+	"golang.org/x/xerrors"
+	"sync"
+)
+
+// Friend is a friend of the bot.
+type Friend struct {
+	ID       int    `json:"id"`
+	Nickname string `json:"nickname"`
+	Remark   string `json:"remark"`
+}
+
+// groupContacts is a cached group with its members.
+type groupContacts struct {
+	Group
+	members map[int]Member
+}
+
+// Contacts caches the friends, groups and members of the bot.
+// It is loaded from mirai once and then kept in sync by events, see ContactSync.
+type Contacts struct {
+	mu      sync.RWMutex
+	friends map[int]Friend
+	groups  map[int]*groupContacts
+}
+
+// NewContacts creates an empty Contacts.
+func NewContacts() *Contacts {
+	return &Contacts{
+		friends: make(map[int]Friend),
+		groups:  make(map[int]*groupContacts),
+	}
+}
+
+// Load replaces the cache with the friend, group and member lists fetched through c.
+func (cs *Contacts) Load(c *Client) error {
+	friends, err := c.FriendList()
+	if err != nil {
+		return xerrors.Errorf("load friends: %w", err)
+	}
+	groupList, err := c.GroupList()
+	if err != nil {
+		return xerrors.Errorf("load groups: %w", err)
+	}
+
+	groups := make(map[int]*groupContacts, len(groupList))
+	for _, g := range groupList {
+		members, err := c.MemberList(g.ID)
+		if err != nil {
+			return xerrors.Errorf("load members of group %d: %w", g.ID, err)
+		}
+		gc := &groupContacts{Group: g, members: make(map[int]Member, len(members))}
+		for _, m := range members {
+			gc.members[m.ID] = m
+		}
+		groups[g.ID] = gc
+	}
+
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	cs.friends = make(map[int]Friend, len(friends))
+	for _, f := range friends {
+		cs.friends[f.ID] = f
+	}
+	cs.groups = groups
+	return nil
+}
+
+// Friend returns a cached friend.
+func (cs *Contacts) Friend(id int) (Friend, bool) {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+	f, ok := cs.friends[id]
+	return f, ok
+}
+
+// Friends returns all cached friends.
+func (cs *Contacts) Friends() []Friend {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+	friends := make([]Friend, 0, len(cs.friends))
+	for _, f := range cs.friends {
+		friends = append(friends, f)
+	}
+	return friends
+}
+
+// Group returns a cached group.
+func (cs *Contacts) Group(id int) (Group, bool) {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+	g, ok := cs.groups[id]
+	if !ok {
+		return Group{}, false
+	}
+	return g.Group, true
+}
+
+// Groups returns all cached groups.
+func (cs *Contacts) Groups() []Group {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+	groups := make([]Group, 0, len(cs.groups))
+	for _, g := range cs.groups {
+		groups = append(groups, g.Group)
+	}
+	return groups
+}
+
+// Member returns a cached group member.
+func (cs *Contacts) Member(group, id int) (Member, bool) {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+	g, ok := cs.groups[group]
+	if !ok {
+		return Member{}, false
+	}
+	m, ok := g.members[id]
+	m.Group = g.Group
+	return m, ok
+}
+
+// Members returns all cached members of a group.
+func (cs *Contacts) Members(group int) []Member {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+	g, ok := cs.groups[group]
+	if !ok {
+		return nil
+	}
+	members := make([]Member, 0, len(g.members))
+	for _, m := range g.members {
+		m.Group = g.Group
+		members = append(members, m)
+	}
+	return members
+}
+
+// Update applies the contact changes carried by an event.
+func (cs *Contacts) Update(e Event) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	switch e := e.(type) {
+	case *FriendAddEvent:
+		cs.friends[e.Friend.ID] = Friend(e.Friend)
+	case *FriendDeleteEvent:
+		delete(cs.friends, e.Friend.ID)
+	case *FriendNickChangedEvent:
+		if f, ok := cs.friends[e.Friend.ID]; ok {
+			f.Nickname = e.To
+			cs.friends[f.ID] = f
+		}
+	case *BotJoinGroupEvent:
+		cs.groups[e.Group.ID] = &groupContacts{Group: Group(e.Group), members: make(map[int]Member)}
+	case *BotLeaveEventActive:
+		delete(cs.groups, e.Group.ID)
+	case *BotLeaveEventKick:
+		delete(cs.groups, e.Group.ID)
+	case *BotLeaveEventDisband:
+		delete(cs.groups, e.Group.ID)
+	case *BotGroupPermissionChangeEvent:
+		if g, ok := cs.groups[e.Group.ID]; ok {
+			g.Permission = e.Current
+		}
+	case *GroupNameChangeEvent:
+		if g, ok := cs.groups[e.Group.ID]; ok {
+			g.Name = e.Current
+		}
+	case *MemberJoinEvent:
+		m := e.Member
+		cs.putMember(m.Group.ID, Member{
+			ID:                 m.ID,
+			MemberName:         m.MemberName,
+			SpecialTitle:       m.SpecialTitle,
+			Permission:         m.Permission,
+			JoinTimestamp:      m.JoinTimestamp,
+			LastSpeakTimestamp: m.LastSpeakTimestamp,
+			MuteTimeRemaining:  m.MuteTimeRemaining,
+		})
+	case *MemberLeaveEventKick:
+		cs.deleteMember(e.Member.Group.ID, e.Member.ID)
+	case *MemberLeaveEventQuit:
+		cs.deleteMember(e.Member.Group.ID, e.Member.ID)
+	case *MemberCardChangeEvent:
+		cs.updateMember(e.Member.Group.ID, e.Member.ID, func(m *Member) { m.MemberName = e.Current })
+	case *MemberSpecialTitleChangeEvent:
+		cs.updateMember(e.Member.Group.ID, e.Member.ID, func(m *Member) { m.SpecialTitle = e.Current })
+	case *MemberPermissionChangeEvent:
+		cs.updateMember(e.Member.Group.ID, e.Member.ID, func(m *Member) { m.Permission = e.Current })
+	case *GroupMessage:
+		s := e.Sender
+		cs.putMember(s.Group.ID, Member{
+			ID:                 s.ID,
+			MemberName:         s.MemberName,
+			SpecialTitle:       s.SpecialTitle,
+			Permission:         s.Permission,
+			JoinTimestamp:      s.JoinTimestamp,
+			LastSpeakTimestamp: s.LastSpeakTimestamp,
+			MuteTimeRemaining:  s.MuteTimeRemaining,
+		})
+	}
+}
+
+// putMember adds or replaces a member of a cached group. The caller must hold cs.mu.
+func (cs *Contacts) putMember(group int, m Member) {
+	if g, ok := cs.groups[group]; ok {
+		g.members[m.ID] = m
+	}
+}
+
+// deleteMember removes a member of a cached group. The caller must hold cs.mu.
+func (cs *Contacts) deleteMember(group, id int) {
+	if g, ok := cs.groups[group]; ok {
+		delete(g.members, id)
+	}
+}
+
+// updateMember modifies a cached member in place. The caller must hold cs.mu.
+func (cs *Contacts) updateMember(group, id int, fn func(m *Member)) {
+	g, ok := cs.groups[group]
+	if !ok {
+		return
+	}
+	if m, ok := g.members[id]; ok {
+		fn(&m)
+		g.members[id] = m
+	}
+}
+
+// LoadMembers fills the members of a cached group with the member list fetched through c.
+func (cs *Contacts) LoadMembers(c *Client, group int) error {
+	members, err := c.MemberList(group)
+	if err != nil {
+		return xerrors.Errorf("load members of group %d: %w", group, err)
+	}
+
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	for _, m := range members {
+		cs.putMember(group, m)
+	}
+	return nil
+}
+
+// ContactSync keeps Bot.Contacts in sync with incoming events.
+// The members of groups the bot joins are loaded in the background.
+func ContactSync() Middleware {
+	return func(c *Context) {
+		if c.Event != nil {
+			c.Contacts.Update(c.Event)
+		}
+		if e, ok := c.Event.(*BotJoinGroupEvent); ok {
+			c.Go(func(c *Context) {
+				if err := c.Contacts.LoadMembers(c.Client, e.Group.ID); err != nil {
+					c.Log().Warn("Failed to load members, the cache will be filled by events: %s", err)
+				}
+			})
+		}
+		c.Next()
+	}
+}
+
+// FriendList returns the friends of the bot.
+func (c *Client) FriendList() ([]Friend, error) {
+	var resp struct {
+		Data []Friend `json:"data"`
+	}
+	if err := c.Get("/friendList", nil, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Data, nil
+}
@@ -1,21 +1,236 @@
 package core
 
-import "github.com/gin-gonic/gin"
+import (
+	"context"
+	"errors"
+	"golang.org/x/xerrors"
+	"sync"
+	"time"
+)
 
+var ErrNoQuote = errors.New("message does not quote another message")
+
+// Middleware is a handler in the chain run for each event.
+type Middleware func(*Context)
+
+// Context carries an event through the middleware chain.
+// It is independent of the transport the event came from: webhook, tests or anything else
+// build one with Bot.NewContext and run the chain with Bot.Dispatch.
+//
+// Context is also a context.Context, done when the event exceeds DispatchConfig.Deadline
+// or the bot shuts down. The embedded Client sends its requests with it, and Namespace binds storage to it.
 type Context struct {
 	Event
 	*Bot
-	gContext *gin.Context
+	*Client
+
+	ctx      context.Context
+	raw      []byte
+	handlers []Middleware
+	index    int
+	aborted  bool
+	onPanic  func(c *Context, r interface{})
+	timing   handlerTiming
+
+	mu   sync.RWMutex
+	keys map[string]interface{}
+}
+
+// NewContext creates a Context for an event. When e is nil, Rx parses raw into the event.
+func (b *Bot) NewContext(e Event, raw []byte) *Context {
+	c := &Context{Event: e, Bot: b, ctx: b.ctx, raw: raw, index: -1}
+	c.Client = b.Client.WithContext(c)
+	return c
+}
+
+// Dispatch runs the middleware chain of the Bot on c, within the per-event deadline.
+func (b *Bot) Dispatch(c *Context) {
+	b.dispatch(c, b.Middlewares)
+}
+
+// dispatch runs handlers on c as its chain.
+func (b *Bot) dispatch(c *Context, handlers []Middleware) {
+	var (
+		ctx    context.Context
+		cancel context.CancelFunc
+	)
+	if d := b.Config.Dispatch.Deadline; d > 0 {
+		ctx, cancel = context.WithTimeout(b.ctx, time.Duration(d)*time.Second)
+	} else {
+		ctx, cancel = context.WithCancel(b.ctx)
+	}
+	defer cancel()
+
+	c.ctx = ctx
+	c.handlers = handlers
+	c.index = -1
+	c.aborted = false
+	c.Next()
+}
+
+// Namespace returns the storage namespace called name, bound to the Context like the embedded Client.
+func (c *Context) Namespace(name string) *Namespace {
+	return c.Storage.Namespace(name).WithContext(c)
+}
+
+// Log returns the logger with structured fields describing the current event and plugin.
+func (c *Context) Log() *Logger {
+	var fields []interface{}
+	if c.Event != nil {
+		fields = append(fields, FieldEventType, c.Event.EventType())
+	}
+	if s, ok := SubjectOf(c.Event); ok {
+		switch s.Kind {
+		case GroupSubject:
+			fields = append(fields, FieldGroupID, s.ID)
+		case TempSubject:
+			fields = append(fields, FieldGroupID, s.Group)
+		}
+	}
+	if e, ok := c.Event.(MessageEvent); ok {
+		fields = append(fields, FieldSenderID, e.SenderID())
+		if src := e.Chain().Source(); src != nil {
+			fields = append(fields, FieldMsgID, src.ID)
+		}
+	}
+	if c.timing.plugin != "" {
+		fields = append(fields, FieldPlugin, c.timing.plugin)
+	}
+	return Log().With(fields...)
+}
+
+// Deadline implements context.Context.
+func (c *Context) Deadline() (time.Time, bool) {
+	return c.ctx.Deadline()
+}
+
+// Done implements context.Context.
+func (c *Context) Done() <-chan struct{} {
+	return c.ctx.Done()
+}
+
+// Err implements context.Context.
+func (c *Context) Err() error {
+	return c.ctx.Err()
+}
+
+// Value implements context.Context, looking up string keys stored with SetValue first.
+func (c *Context) Value(key interface{}) interface{} {
+	if k, ok := key.(string); ok {
+		c.mu.RLock()
+		v, ok := c.keys[k]
+		c.mu.RUnlock()
+		if ok {
+			return v
+		}
+	}
+	return c.ctx.Value(key)
 }
 
+// GetRawData returns the undecoded event the Context was created with.
 func (c *Context) GetRawData() ([]byte, error) {
-	return c.gContext.GetRawData()
+	if c.raw == nil {
+		return nil, errors.New("context has no raw data")
+	}
+	return c.raw, nil
 }
 
+// Next runs the remaining middlewares of the chain. A middleware returning without
+// calling Next lets the chain continue anyway, unless it called Abort.
 func (c *Context) Next() {
-	c.gContext.Next()
+	c.index++
+	for c.index < len(c.handlers) && !c.aborted {
+		c.timed(c.handlers[c.index])
+		c.index++
+	}
 }
 
+// Abort prevents the remaining middlewares from running.
 func (c *Context) Abort() {
-	c.gContext.Abort()
+	c.aborted = true
+}
+
+// IsAborted reports whether the chain was aborted.
+func (c *Context) IsAborted() bool {
+	return c.aborted
+}
+
+// SetValue stores a value in the Context for the following middlewares, see Value.
+func (c *Context) SetValue(key string, value interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.keys == nil {
+		c.keys = make(map[string]interface{})
+	}
+	c.keys[key] = value
+}
+
+// Copy returns a copy of the Context safe to use outside of the chain. Its Next and Abort do nothing.
+// The copy is not bound to the deadline of the event, only to the bot shutting down.
+func (c *Context) Copy() *Context {
+	cp := c.NewContext(c.Event, c.raw)
+	cp.timing.plugin = c.timing.plugin
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.keys != nil {
+		cp.keys = make(map[string]interface{}, len(c.keys))
+		for k, v := range c.keys {
+			cp.keys[k] = v
+		}
+	}
+	return cp
+}
+
+// Send sends chain to the chat the current message event came from.
+func (c *Context) Send(chain MessageChain) (int, error) {
+	e, ok := c.Event.(MessageEvent)
+	if !ok {
+		return 0, xerrors.Errorf("%s is not a message event", c.Event.EventType())
+	}
+	return c.SendMessage(e.Subject(), chain)
+}
+
+// SendText sends a formatted text to the chat the current message event came from.
+func (c *Context) SendText(format string, a ...interface{}) (int, error) {
+	return c.Send(Text(format, a...))
+}
+
+// Reply sends chain to the chat the current message event came from, quoting that message.
+func (c *Context) Reply(chain MessageChain) (int, error) {
+	e, ok := c.Event.(MessageEvent)
+	if !ok {
+		return 0, xerrors.Errorf("%s is not a message event", c.Event.EventType())
+	}
+	quote := 0
+	if src := e.Chain().Source(); src != nil {
+		quote = src.ID
+	}
+	return c.SendQuote(e.Subject(), quote, chain)
+}
+
+// ReplyText replies to the current message with a formatted text.
+func (c *Context) ReplyText(format string, a ...interface{}) (int, error) {
+	return c.Reply(Text(format, a...))
+}
+
+// Quoted returns the message the current message replies to.
+// The chain carried by Quote.Origin is used when present, otherwise the message is looked up by ID.
+func (c *Context) Quoted() (*StoredMessage, error) {
+	e, ok := c.Event.(MessageEvent)
+	if !ok {
+		return nil, xerrors.Errorf("%s is not a message event", c.Event.EventType())
+	}
+	q := e.Chain().Quote()
+	if q == nil {
+		return nil, ErrNoQuote
+	}
+
+	subject := e.Subject()
+	if q.GroupID != 0 {
+		subject = Subject{Kind: GroupSubject, ID: q.GroupID}
+	}
+	if len(q.Origin) > 0 {
+		return &StoredMessage{ID: q.ID, Subject: subject, SenderID: q.SenderID, Chain: q.Origin}, nil
+	}
+	return c.lookupMessage(subject, q.ID)
 }
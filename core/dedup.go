@@ -0,0 +1,94 @@
+package core
+
+import (
+	"encoding/json"
+	"hash/fnv"
+	"sync/atomic"
+	"time"
+)
+
+// DedupConfig holds the settings of duplicate event suppression.
+type DedupConfig struct {
+	Enable       bool `yaml:"enable"`        // Drop events delivered twice
+	Size         int  `yaml:"size"`          // Max events remembered
+	Window       int  `yaml:"window"`        // Seconds a message is remembered
+	NoticeWindow int  `yaml:"notice_window"` // Seconds a notice is remembered, keep it short as identical notices can be legit
+}
+
+// DefaultDedupConfig provides a basic default DedupConfig.
+func DefaultDedupConfig() DedupConfig {
+	return DedupConfig{
+		Enable:       true,
+		Size:         4096,
+		Window:       300,
+		NoticeWindow: 5,
+	}
+}
+
+// messageID identifies a delivered message by its chat and Source.
+type messageID struct {
+	Subject Subject
+	ID      int
+	Time    int
+}
+
+// Deduplicator remembers recent events to recognize the ones mirai delivers twice,
+// e.g. after reconnecting. Messages are keyed by their Source, other events by a hash of their content.
+type Deduplicator struct {
+	messages *lruCache[messageID, struct{}]
+	notices  *lruCache[uint64, struct{}]
+	dropped  atomic.Uint64
+}
+
+// NewDeduplicator creates a Deduplicator from cfg.
+func NewDeduplicator(cfg DedupConfig) *Deduplicator {
+	return &Deduplicator{
+		messages: newLRUCache[messageID, struct{}](cfg.Size, time.Duration(cfg.Window)*time.Second),
+		notices:  newLRUCache[uint64, struct{}](cfg.Size, time.Duration(cfg.NoticeWindow)*time.Second),
+	}
+}
+
+// Seen records an event and reports whether it was already seen within the window.
+// raw is the JSON the event was parsed from, if any.
+func (d *Deduplicator) Seen(e Event, raw []byte) bool {
+	var seen bool
+	if m, ok := e.(MessageEvent); ok {
+		src := m.Chain().Source()
+		if src == nil {
+			return false
+		}
+		seen = d.messages.Add(messageID{Subject: m.Subject(), ID: src.ID, Time: src.Time}, struct{}{})
+	} else {
+		if raw == nil {
+			var err error
+			if raw, err = json.Marshal(e); err != nil {
+				return false
+			}
+		}
+		h := fnv.New64a()
+		h.Write([]byte(e.EventType()))
+		h.Write(raw)
+		seen = d.notices.Add(h.Sum64(), struct{}{})
+	}
+	if seen {
+		d.dropped.Add(1)
+	}
+	return seen
+}
+
+// Dropped returns the number of duplicates seen so far.
+func (d *Deduplicator) Dropped() uint64 {
+	return d.dropped.Load()
+}
+
+// Dedup aborts the chain for events already seen, see Deduplicator.
+func Dedup() Middleware {
+	return func(c *Context) {
+		if c.Deduplicator != nil && c.Deduplicator.Seen(c.Event, c.raw) {
+			c.Log().Debug("Dropped duplicate %s.", c.Event.EventType())
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,172 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var ErrQueueFull = errors.New("event queue is full")
+
+// DispatchConfig holds the settings of the event worker pool.
+type DispatchConfig struct {
+	Workers  int `yaml:"workers"`  // Number of workers, events of a chat always go to the same one
+	Queue    int `yaml:"queue"`    // Queue length of each worker
+	Timeout  int `yaml:"timeout"`  // Milliseconds to wait on a full queue before dropping an event
+	Deadline int `yaml:"deadline"` // Seconds the handlers of an event may run before its context is cancelled, 0 for none
+}
+
+// DefaultDispatchConfig provides a basic default DispatchConfig.
+func DefaultDispatchConfig() DispatchConfig {
+	return DispatchConfig{
+		Workers:  8,
+		Queue:    64,
+		Timeout:  1000,
+		Deadline: 60,
+	}
+}
+
+// DispatchStats counts the events going through a Dispatcher.
+type DispatchStats struct {
+	Queued    int    `json:"queued"`    // Events waiting in the queues
+	Processed uint64 `json:"processed"` // Events run through the chain
+	Dropped   uint64 `json:"dropped"`   // Events dropped on full queues
+}
+
+// Dispatcher runs the middleware chain on a pool of workers.
+// Events of the same chat are queued to the same worker and run in order,
+// while different chats run in parallel. Events outside of any chat share a single worker.
+type Dispatcher struct {
+	bot     *Bot
+	timeout time.Duration
+	queues  []chan *Context
+	wg      sync.WaitGroup
+
+	mu      sync.RWMutex
+	started bool
+	closed  bool
+
+	processed atomic.Uint64
+	dropped   atomic.Uint64
+}
+
+// NewDispatcher creates a Dispatcher running the chain of b.
+func NewDispatcher(b *Bot, cfg DispatchConfig) *Dispatcher {
+	workers, queue := cfg.Workers, cfg.Queue
+	if workers < 1 {
+		workers = 1
+	}
+	if queue < 1 {
+		queue = 1
+	}
+	d := &Dispatcher{
+		bot:     b,
+		timeout: time.Duration(cfg.Timeout) * time.Millisecond,
+		queues:  make([]chan *Context, workers),
+	}
+	for i := range d.queues {
+		d.queues[i] = make(chan *Context, queue)
+	}
+	return d
+}
+
+// Start starts the workers.
+func (d *Dispatcher) Start() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.started || d.closed {
+		return
+	}
+	d.started = true
+	for _, q := range d.queues {
+		d.wg.Add(1)
+		go d.work(q)
+	}
+}
+
+// work runs the chain on the events of a queue until it is closed.
+func (d *Dispatcher) work(q chan *Context) {
+	defer d.wg.Done()
+	for c := range q {
+		d.bot.Dispatch(c)
+		d.processed.Add(1)
+	}
+}
+
+// Enqueue queues c to the worker of its chat. When that queue is full, Enqueue waits
+// up to the configured timeout, then drops the event and returns ErrQueueFull.
+// Messages awaited by a handler run at once instead, as that handler may be holding up the queue.
+// It returns ErrBotStopped once the Dispatcher is stopped.
+func (d *Dispatcher) Enqueue(c *Context) error {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	if d.closed {
+		return ErrBotStopped
+	}
+	if e, ok := c.Event.(MessageEvent); ok && d.bot.waiters.accepts(e) {
+		d.wg.Add(1)
+		go func() {
+			defer d.wg.Done()
+			d.bot.Dispatch(c)
+			d.processed.Add(1)
+		}()
+		return nil
+	}
+
+	q := d.queues[d.shard(c.Event)]
+	select {
+	case q <- c:
+		return nil
+	default:
+	}
+
+	timer := time.NewTimer(d.timeout)
+	defer timer.Stop()
+	select {
+	case q <- c:
+		return nil
+	case <-timer.C:
+		d.dropped.Add(1)
+		return ErrQueueFull
+	}
+}
+
+// shard returns the index of the worker handling the chat of e.
+func (d *Dispatcher) shard(e Event) int {
+	chat, ok := FeatureChat(e)
+	if !ok {
+		return 0
+	}
+	h := fnv.New32a()
+	fmt.Fprintf(h, "%s:%d", chat.Kind, chat.ID)
+	return int(h.Sum32() % uint32(len(d.queues)))
+}
+
+// Stop stops accepting events and waits for the queued ones to be processed until ctx is done.
+func (d *Dispatcher) Stop(ctx context.Context) error {
+	d.mu.Lock()
+	if !d.closed {
+		d.closed = true
+		for _, q := range d.queues {
+			close(q)
+		}
+	}
+	d.mu.Unlock()
+	return waitGroup(ctx, &d.wg)
+}
+
+// Stats returns the current counters of the Dispatcher.
+func (d *Dispatcher) Stats() DispatchStats {
+	s := DispatchStats{
+		Processed: d.processed.Load(),
+		Dropped:   d.dropped.Load(),
+	}
+	for _, q := range d.queues {
+		s.Queued += len(q)
+	}
+	return s
+}
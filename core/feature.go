@@ -0,0 +1,263 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"golang.org/x/xerrors"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrUnknownFeature = errors.New("unknown feature")
+
+// featureKey is a feature switched off in a chat.
+type featureKey struct {
+	Chat Subject
+	Name string
+}
+
+// Features holds per-group and per-friend switches of plugins and other features.
+// Everything is enabled unless switched off. Switches are persisted in Storage
+// and cached in memory, so checking them costs a map lookup.
+type Features struct {
+	ns *Namespace
+
+	once     sync.Once
+	mu       sync.RWMutex
+	declared map[string]struct{}
+	disabled map[featureKey]struct{}
+}
+
+// NewFeatures creates Features persisted in s.
+func NewFeatures(s *Storage) *Features {
+	return &Features{
+		ns:       s.Namespace("koharu.features"),
+		declared: make(map[string]struct{}),
+		disabled: make(map[featureKey]struct{}),
+	}
+}
+
+// FeatureChat returns the chat whose switches apply to an event: its group, or the friend for private chats.
+func FeatureChat(e Event) (Subject, bool) {
+	s, ok := SubjectOf(e)
+	if !ok {
+		return Subject{}, false
+	}
+	switch s.Kind {
+	case GroupSubject:
+		return Subject{Kind: GroupSubject, ID: s.ID}, true
+	case TempSubject:
+		return Subject{Kind: GroupSubject, ID: s.Group}, true
+	default:
+		return Subject{Kind: FriendSubject, ID: s.ID}, true
+	}
+}
+
+// featureStorageKey encodes a featureKey as "Group:123:name".
+func featureStorageKey(k featureKey) string {
+	return fmt.Sprintf("%s:%d:%s", k.Chat.Kind, k.Chat.ID, k.Name)
+}
+
+// load reads the persisted switches on first use.
+func (f *Features) load() {
+	f.once.Do(func() {
+		err := Scan(f.ns, "", func(key string, _ bool) error {
+			parts := strings.SplitN(key, ":", 3)
+			if len(parts) != 3 {
+				return nil
+			}
+			id, err := strconv.Atoi(parts[1])
+			if err != nil {
+				return nil
+			}
+			f.disabled[featureKey{Subject{Kind: SubjectKind(parts[0]), ID: id}, parts[2]}] = struct{}{}
+			return nil
+		})
+		if err != nil {
+			Log().Error("Failed to load feature switches, all features are enabled: %s", err)
+		}
+	})
+}
+
+// Declare registers feature names that can be switched, besides plugin names.
+func (f *Features) Declare(names ...string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, name := range names {
+		f.declared[name] = struct{}{}
+	}
+}
+
+// Declared reports whether name can be switched.
+func (f *Features) Declared(name string) bool {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	_, ok := f.declared[name]
+	return ok
+}
+
+// Enabled reports whether a feature is enabled in a chat.
+func (f *Features) Enabled(chat Subject, name string) bool {
+	f.load()
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	_, off := f.disabled[featureKey{chat, name}]
+	return !off
+}
+
+// SetEnabled switches a feature on or off in a chat.
+func (f *Features) SetEnabled(chat Subject, name string, enabled bool) error {
+	return f.setEnabled(context.Background(), chat, name, enabled)
+}
+
+// setEnabled is SetEnabled saving the switch unless ctx is done.
+func (f *Features) setEnabled(ctx context.Context, chat Subject, name string, enabled bool) error {
+	f.load()
+	k := featureKey{chat, name}
+	ns := f.ns.WithContext(ctx)
+
+	var err error
+	if enabled {
+		err = ns.Delete(featureStorageKey(k))
+	} else {
+		err = Put(ns, featureStorageKey(k), true, time.Duration(0))
+	}
+	if err != nil {
+		return xerrors.Errorf("save feature switch: %w", err)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if enabled {
+		delete(f.disabled, k)
+	} else {
+		f.disabled[k] = struct{}{}
+	}
+	return nil
+}
+
+// Disabled returns the features switched off in a chat.
+func (f *Features) Disabled(chat Subject) []string {
+	f.load()
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	var names []string
+	for k := range f.disabled {
+		if k.Chat == chat {
+			names = append(names, k.Name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// FeatureEnabled reports whether a feature is enabled in the chat of the current event.
+// Events outside of any chat always have every feature enabled.
+func (c *Context) FeatureEnabled(name string) bool {
+	chat, ok := FeatureChat(c.Event)
+	return !ok || c.Features.Enabled(chat, name)
+}
+
+// pluginMiddleware skips m when the plugin is switched off in the chat of the event.
+func pluginMiddleware(name string, m Middleware) Middleware {
+	return func(c *Context) {
+		c.timing.plugin = name
+		if !c.FeatureEnabled(name) {
+			c.Next()
+			return
+		}
+		m(c)
+	}
+}
+
+// canSwitchFeatures reports whether the sender of the current message may toggle features of its chat:
+// bot admins everywhere, and group owners and administrators in their group.
+func (c *Context) canSwitchFeatures(e MessageEvent) bool {
+	if c.IsAdmin(e.SenderID()) {
+		return true
+	}
+	if g, ok := e.(*GroupMessage); ok {
+		return hasPermission(g.Sender.Permission, PermissionAdministrator)
+	}
+	return false
+}
+
+// switchable reports whether name is a plugin or a declared feature.
+func (b *Bot) switchable(name string) bool {
+	if b.Features.Declared(name) {
+		return true
+	}
+	for _, p := range b.Plugins() {
+		if p.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// SwitchFeature switches a plugin or declared feature on or off in a chat, recording it in the audit log.
+func (b *Bot) SwitchFeature(ctx context.Context, chat Subject, name string, enabled bool) error {
+	if !b.switchable(name) {
+		return xerrors.Errorf("%s: %w", name, ErrUnknownFeature)
+	}
+	err := b.Features.setEnabled(ctx, chat, name, enabled)
+	b.Audit.Record(ctx, "feature", map[string]interface{}{
+		"chat": chat.Kind, "id": chat.ID, "name": name, "enabled": enabled,
+	}, err)
+	return err
+}
+
+// featureCommands let admins switch features in their chat.
+func featureCommands() []*Command {
+	toggle := func(enabled bool) func(c *Context, args []string) {
+		return func(c *Context, args []string) {
+			e := c.Event.(MessageEvent)
+			if !c.canSwitchFeatures(e) {
+				c.SendText("Only group admins and bot admins can switch features.")
+				return
+			}
+			if len(args) == 0 {
+				c.SendText("Missing feature name.")
+				return
+			}
+
+			chat, _ := FeatureChat(e)
+			if err := c.SwitchFeature(c, chat, args[0], enabled); err != nil {
+				if xerrors.Is(err, ErrUnknownFeature) {
+					c.SendText("Unknown feature: %s", args[0])
+					return
+				}
+				c.Log().Error("Failed to switch feature %s: %s", args[0], err)
+				c.SendText("Failed to switch %s.", args[0])
+				return
+			}
+			state := "disabled"
+			if enabled {
+				state = "enabled"
+			}
+			c.SendText("%s %s here.", args[0], state)
+		}
+	}
+
+	return []*Command{
+		{Name: "enable", Usage: "enable a plugin or feature in this chat: enable <name>", Handler: toggle(true)},
+		{Name: "disable", Usage: "disable a plugin or feature in this chat: disable <name>", Handler: toggle(false)},
+		{
+			Name:  "features",
+			Usage: "list the features disabled in this chat",
+			Handler: func(c *Context, args []string) {
+				chat, _ := FeatureChat(c.Event)
+				disabled := c.Features.Disabled(chat)
+				if len(disabled) == 0 {
+					c.SendText("Everything is enabled here.")
+					return
+				}
+				c.SendText("Disabled here: %s", strings.Join(disabled, ", "))
+			},
+		},
+	}
+}
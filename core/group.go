@@ -0,0 +1,259 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"golang.org/x/xerrors"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Member permissions within a group.
+const (
+	PermissionOwner         = "OWNER"
+	PermissionAdministrator = "ADMINISTRATOR"
+	PermissionMember        = "MEMBER"
+)
+
+// ErrOwnerCannotQuit is returned by Quit when the bot owns the group, owners can only disband it.
+var ErrOwnerCannotQuit = errors.New("the group owner can't quit")
+
+// MaxMuteDuration is the longest mute QQ allows.
+const MaxMuteDuration = 30 * 24 * time.Hour
+
+// Group is a QQ group as seen by the bot, Permission being the bot's own.
+type Group struct {
+	ID         int    `json:"id"`
+	Name       string `json:"name"`
+	Permission string `json:"permission"`
+}
+
+// Member is a member of a group.
+type Member struct {
+	ID                 int    `json:"id"`
+	MemberName         string `json:"memberName"`
+	SpecialTitle       string `json:"specialTitle"`
+	Permission         string `json:"permission"`
+	JoinTimestamp      int    `json:"joinTimestamp"`
+	LastSpeakTimestamp int    `json:"lastSpeakTimestamp"`
+	MuteTimeRemaining  int    `json:"muteTimeRemaining"`
+	Group              Group  `json:"group"`
+}
+
+// GroupConfig holds the settings of a group.
+type GroupConfig struct {
+	Name              string `json:"name,omitempty"`
+	Announcement      string `json:"announcement,omitempty"`
+	ConfessTalk       bool   `json:"confessTalk"`
+	AllowMemberInvite bool   `json:"allowMemberInvite"`
+	AutoApprove       bool   `json:"autoApprove"`
+	AnonymousChat     bool   `json:"anonymousChat"`
+	MuteAll           bool   `json:"muteAll"`
+}
+
+// MemberInfo holds the editable profile of a group member.
+// Empty fields are left unchanged.
+type MemberInfo struct {
+	Name         string `json:"name,omitempty"`
+	SpecialTitle string `json:"specialTitle,omitempty"`
+}
+
+// PermissionError is returned when the bot lacks the permission an action requires.
+type PermissionError struct {
+	Action string
+	Group  int
+	Have   string
+	Need   string
+}
+
+func (e *PermissionError) Error() string {
+	return fmt.Sprintf("%s in group %d requires %s, bot is %s", e.Action, e.Group, e.Need, e.Have)
+}
+
+// hasPermission reports whether have is at least need.
+func hasPermission(have, need string) bool {
+	switch need {
+	case PermissionOwner:
+		return have == PermissionOwner
+	case PermissionAdministrator:
+		return have == PermissionOwner || have == PermissionAdministrator
+	default:
+		return true
+	}
+}
+
+// GroupList returns the groups the bot is in.
+func (c *Client) GroupList() ([]Group, error) {
+	var resp struct {
+		Data []Group `json:"data"`
+	}
+	if err := c.Get("/groupList", nil, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Data, nil
+}
+
+// MemberList returns the members of a group.
+func (c *Client) MemberList(group int) ([]Member, error) {
+	var resp struct {
+		Data []Member `json:"data"`
+	}
+	if err := c.Get("/memberList", url.Values{"target": {strconv.Itoa(group)}}, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Data, nil
+}
+
+// botPermission returns the bot's permission in a group, preferring the contact cache.
+func (c *Client) botPermission(group int) (string, error) {
+	if c.contacts != nil {
+		if g, ok := c.contacts.Group(group); ok {
+			return g.Permission, nil
+		}
+	}
+
+	groups, err := c.GroupList()
+	if err != nil {
+		return "", err
+	}
+	for _, g := range groups {
+		if g.ID == group {
+			return g.Permission, nil
+		}
+	}
+	return "", &APIError{Endpoint: "/groupList", Code: CodeTargetNotFound, Msg: fmt.Sprintf("bot is not in group %d", group)}
+}
+
+// requirePermission returns a *PermissionError if the bot is below need in group.
+func (c *Client) requirePermission(action string, group int, need string) error {
+	have, err := c.botPermission(group)
+	if err != nil {
+		return xerrors.Errorf("check permission for %s: %w", action, err)
+	}
+	if !hasPermission(have, need) {
+		return &PermissionError{Action: action, Group: group, Have: have, Need: need}
+	}
+	return nil
+}
+
+// Mute mutes a member for d, which is rounded down to seconds.
+func (c *Client) Mute(group, member int, d time.Duration) error {
+	if d < time.Second || d > MaxMuteDuration {
+		return xerrors.Errorf("mute duration %s out of range [1s, %s]", d, MaxMuteDuration)
+	}
+	if err := c.requirePermission("mute", group, PermissionAdministrator); err != nil {
+		return err
+	}
+	return c.Post("/mute", map[string]interface{}{
+		"target":   group,
+		"memberId": member,
+		"time":     int(d / time.Second),
+	}, nil)
+}
+
+// Unmute lifts the mute of a member.
+func (c *Client) Unmute(group, member int) error {
+	if err := c.requirePermission("unmute", group, PermissionAdministrator); err != nil {
+		return err
+	}
+	return c.Post("/unmute", map[string]interface{}{"target": group, "memberId": member}, nil)
+}
+
+// MuteAll mutes the whole group.
+func (c *Client) MuteAll(group int) error {
+	if err := c.requirePermission("muteAll", group, PermissionAdministrator); err != nil {
+		return err
+	}
+	return c.Post("/muteAll", map[string]interface{}{"target": group}, nil)
+}
+
+// UnmuteAll lifts the group-wide mute.
+func (c *Client) UnmuteAll(group int) error {
+	if err := c.requirePermission("unmuteAll", group, PermissionAdministrator); err != nil {
+		return err
+	}
+	return c.Post("/unmuteAll", map[string]interface{}{"target": group}, nil)
+}
+
+// Kick removes a member from the group, optionally blocking further join requests.
+func (c *Client) Kick(group, member int, msg string, block bool) error {
+	if err := c.requirePermission("kick", group, PermissionAdministrator); err != nil {
+		return err
+	}
+	return c.Post("/kick", map[string]interface{}{
+		"target":   group,
+		"memberId": member,
+		"block":    block,
+		"msg":      msg,
+	}, nil)
+}
+
+// Quit makes the bot leave a group. It returns ErrOwnerCannotQuit if the bot owns the group.
+func (c *Client) Quit(group int) error {
+	have, err := c.botPermission(group)
+	if err != nil {
+		return xerrors.Errorf("check permission for quit: %w", err)
+	}
+	if have == PermissionOwner {
+		return xerrors.Errorf("quit group %d: %w", group, ErrOwnerCannotQuit)
+	}
+	return c.Post("/quit", map[string]interface{}{"target": group}, nil)
+}
+
+// SetEssence marks a group message as essence.
+func (c *Client) SetEssence(group, messageID int) error {
+	if err := c.requirePermission("setEssence", group, PermissionAdministrator); err != nil {
+		return err
+	}
+	return c.Post("/setEssence", map[string]interface{}{"target": group, "messageId": messageID}, nil)
+}
+
+// GroupConfig returns the settings of a group.
+func (c *Client) GroupConfig(group int) (*GroupConfig, error) {
+	var cfg GroupConfig
+	if err := c.Get("/groupConfig", url.Values{"target": {strconv.Itoa(group)}}, &cfg); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// SetGroupConfig replaces the settings of a group.
+// Fetch the current settings with GroupConfig and modify them to change only some fields.
+func (c *Client) SetGroupConfig(group int, cfg GroupConfig) error {
+	if err := c.requirePermission("setGroupConfig", group, PermissionAdministrator); err != nil {
+		return err
+	}
+	return c.Post("/groupConfig", map[string]interface{}{"target": group, "config": cfg}, nil)
+}
+
+// MemberInfo returns the profile of a group member.
+func (c *Client) MemberInfo(group, member int) (*Member, error) {
+	var m Member
+	q := url.Values{"target": {strconv.Itoa(group)}, "memberId": {strconv.Itoa(member)}}
+	if err := c.Get("/memberInfo", q, &m); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// SetMemberInfo changes the card and special title of a member.
+// Setting a special title requires the bot to be the owner.
+func (c *Client) SetMemberInfo(group, member int, info MemberInfo) error {
+	need := PermissionAdministrator
+	if info.SpecialTitle != "" {
+		need = PermissionOwner
+	}
+	if err := c.requirePermission("setMemberInfo", group, need); err != nil {
+		return err
+	}
+	return c.Post("/memberInfo", map[string]interface{}{"target": group, "memberId": member, "info": info}, nil)
+}
+
+// SetMemberAdmin grants or revokes the administrator role of a member.
+func (c *Client) SetMemberAdmin(group, member int, assign bool) error {
+	if err := c.requirePermission("memberAdmin", group, PermissionOwner); err != nil {
+		return err
+	}
+	return c.Post("/memberAdmin", map[string]interface{}{"target": group, "memberId": member, "assign": assign}, nil)
+}
@@ -0,0 +1,223 @@
+package core
+
+import (
+	"context"
+	"github.com/gin-gonic/gin"
+	"golang.org/x/xerrors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// OnlineState is the state of the QQ account as reported by mirai.
+type OnlineState string
+
+const (
+	StateUnknown OnlineState = "unknown" // No online or offline event seen yet
+	StateOnline  OnlineState = "online"
+	StateOffline OnlineState = "offline"
+)
+
+// HealthConfig holds the settings of the health checks.
+type HealthConfig struct {
+	Probe    bool `yaml:"probe"`    // Check that mirai is reachable through its /about endpoint
+	Interval int  `yaml:"interval"` // Seconds between two probes
+}
+
+// DefaultHealthConfig provides a basic default HealthConfig.
+func DefaultHealthConfig() HealthConfig {
+	return HealthConfig{
+		Probe:    true,
+		Interval: 30,
+	}
+}
+
+// StateChange describes a change of the online state of the account.
+type StateChange struct {
+	From   OnlineState
+	To     OnlineState
+	Reason string // Type of the event causing the change
+	Time   time.Time
+}
+
+// Health tracks the online state of the account and whether mirai is reachable.
+type Health struct {
+	bot *Bot
+
+	mu       sync.RWMutex
+	state    OnlineState
+	since    time.Time
+	miraiErr error
+	hooks    []func(b *Bot, ch StateChange)
+}
+
+// NewHealth creates a Health tracker for b.
+func NewHealth(b *Bot) *Health {
+	return &Health{bot: b, state: StateUnknown, since: time.Now()}
+}
+
+// State returns the online state of the account and since when it holds.
+func (h *Health) State() (OnlineState, time.Time) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.state, h.since
+}
+
+// Ready returns why the bot can't serve, or nil: the account is offline or mirai is unreachable.
+// An unknown state counts as ready, as the account may have logged in before the bot started.
+func (h *Health) Ready() error {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	if h.state == StateOffline {
+		return xerrors.Errorf("account offline since %s", h.since.Format(time.RFC3339))
+	}
+	if h.miraiErr != nil {
+		return xerrors.Errorf("mirai unreachable: %w", h.miraiErr)
+	}
+	return nil
+}
+
+// OnStateChange registers fn to be called when the online state of the account changes,
+// e.g. to alert admins. Hooks run in the order they were registered, on the event worker.
+func (h *Health) OnStateChange(fn func(b *Bot, ch StateChange)) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.hooks = append(h.hooks, fn)
+}
+
+// set changes the online state and runs the hooks.
+func (h *Health) set(state OnlineState, reason string) {
+	h.mu.Lock()
+	if h.state == state {
+		h.mu.Unlock()
+		return
+	}
+	ch := StateChange{From: h.state, To: state, Reason: reason, Time: time.Now()}
+	h.state, h.since = state, ch.Time
+	hooks := h.hooks
+	h.mu.Unlock()
+
+	Log().Info("Account is %s (%s).", state, reason)
+	for _, fn := range hooks {
+		if err := safeCall(func() error { fn(h.bot, ch); return nil }); err != nil {
+			Log().Error("State change hook failed: %s", err)
+		}
+	}
+}
+
+// probe checks that mirai answers on /about.
+func (h *Health) probe(ctx context.Context) {
+	_, err := h.bot.Client.WithContext(ctx).About()
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if err != nil && h.miraiErr == nil {
+		Log().Warn("Mirai is unreachable: %s", err)
+	} else if err == nil && h.miraiErr != nil {
+		Log().Info("Mirai is reachable again.")
+	}
+	h.miraiErr = err
+}
+
+// About returns the version of mirai-api-http.
+func (c *Client) About() (string, error) {
+	var resp struct {
+		Data struct {
+			Version string `json:"version"`
+		} `json:"data"`
+	}
+	// no session needed, so the probe doesn't depend on the verify key
+	c.pending.add()
+	defer c.pending.done()
+	if err := c.send(http.MethodGet, "/about", nil, nil, &resp); err != nil {
+		return "", err
+	}
+	return resp.Data.Version, nil
+}
+
+// TrackState follows the online state of the account through mirai events.
+func TrackState() Middleware {
+	return func(c *Context) {
+		switch c.Event.(type) {
+		case *BotOnlineEvent, *BotReloginEvent:
+			c.Health.set(StateOnline, c.Event.EventType())
+		case *BotOfflineEventActive, *BotOfflineEventForce, *BotOfflineEventDropped:
+			c.Health.set(StateOffline, c.Event.EventType())
+		}
+		c.Next()
+	}
+}
+
+// setupHealth registers /healthz, answering as long as the process serves HTTP,
+// and /readyz, answering 503 when the account is offline or mirai is unreachable.
+func (b *Bot) setupHealth() {
+	b.Server.GET("/healthz", func(gc *gin.Context) {
+		gc.JSON(http.StatusOK, gin.H{"status": "ok"})
+	})
+	b.Server.GET("/readyz", func(gc *gin.Context) {
+		state, since := b.Health.State()
+		body := gin.H{"status": "ok", "account": state, "since": since}
+		if err := b.Health.Ready(); err != nil {
+			body["status"], body["error"] = "unavailable", err.Error()
+			gc.JSON(http.StatusServiceUnavailable, body)
+			return
+		}
+		gc.JSON(http.StatusOK, body)
+	})
+
+	if !b.Config.Health.Probe {
+		return
+	}
+	b.Health.probe(b.ctx)
+	err := b.Scheduler.Every("koharu.health", time.Duration(b.Config.Health.Interval)*time.Second, func(jc *JobContext) error {
+		b.Health.probe(jc)
+		return nil
+	})
+	if err != nil {
+		Log().Error("Failed to schedule mirai probe: %s", err)
+	}
+}
+
+// BotStatus summarizes the state of a Bot.
+type BotStatus struct {
+	Account    OnlineState    `json:"account"`
+	Since      time.Time      `json:"since"`
+	Ready      bool           `json:"ready"`
+	Error      string         `json:"error,omitempty"`
+	Plugins    []PluginStatus `json:"plugins"`
+	Dispatch   DispatchStats  `json:"dispatch"`
+	Duplicates uint64         `json:"duplicates"`
+}
+
+// Status returns the current status of the bot.
+func (b *Bot) Status() BotStatus {
+	s := BotStatus{Plugins: b.Plugins(), Dispatch: b.Dispatcher.Stats()}
+	s.Account, s.Since = b.Health.State()
+	s.Ready = true
+	if err := b.Health.Ready(); err != nil {
+		s.Ready, s.Error = false, err.Error()
+	}
+	if b.Deduplicator != nil {
+		s.Duplicates = b.Deduplicator.Dropped()
+	}
+	return s
+}
+
+// statusCommand reports the status of the bot.
+func statusCommand() *Command {
+	return &Command{
+		Name:  "status",
+		Usage: "show the account state and event counters",
+		Admin: true,
+		Handler: func(c *Context, args []string) {
+			s := c.Status()
+			ready := "ready"
+			if !s.Ready {
+				ready = s.Error
+			}
+			c.SendText("Account %s since %s, %s.\nEvents: %d processed, %d queued, %d dropped, %d duplicates.\nPlugins: %d.",
+				s.Account, s.Since.Format(time.DateTime), ready,
+				s.Dispatch.Processed, s.Dispatch.Queued, s.Dispatch.Dropped, s.Duplicates, len(s.Plugins))
+		},
+	}
+}
@@ -1,11 +1,17 @@
 package core
 
 import (
+	"context"
+	"fmt"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
+	"golang.org/x/xerrors"
 	"gopkg.in/natefinch/lumberjack.v2"
 	"os"
+	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
 )
 
 // LogLevel defines the level of logging.
@@ -19,62 +25,136 @@ const (
 	FatalLevel LogLevel = "fatal"
 )
 
+// valid reports whether l is a known level.
+func (l LogLevel) valid() bool {
+	switch l {
+	case DebugLevel, InfoLevel, WarnLevel, ErrorLevel, FatalLevel:
+		return true
+	}
+	return false
+}
+
+// Keys of the structured fields attached to log entries.
+const (
+	FieldEventType = "event_type"
+	FieldGroupID   = "group_id"
+	FieldSenderID  = "sender_id"
+	FieldMsgID     = "msg_id"
+	FieldPlugin    = "plugin"
+)
+
+// LogFormat defines how log entries are encoded.
+type LogFormat string
+
+const (
+	ColorFormat LogFormat = "color" // Text with colored levels
+	TextFormat  LogFormat = "text"  // Plain text
+	JSONFormat  LogFormat = "json"  // One JSON object per line
+)
+
+// Log sinks, see LogSinks.
+const (
+	ConsoleSink = "console"
+	FileSink    = "file"
+)
+
+// SinkConfig holds the settings of a log output.
+type SinkConfig struct {
+	Level  LogLevel  `yaml:"level"`  // Overrides LoggerConfig.Level if set
+	Format LogFormat `yaml:"format"` // color, text or json
+}
+
+// LogSinks holds the settings of each log output.
+type LogSinks struct {
+	Console SinkConfig `yaml:"console"`
+	File    SinkConfig `yaml:"file"`
+}
+
 // LoggerConfig holds Logger configurations.
 type LoggerConfig struct {
-	File     string   `yaml:"file"`     // Log file path
-	Level    LogLevel `yaml:"level"`    // Log Level
-	MaxDays  int      `yaml:"max_days"` // Max days to rotate logs
-	Compress bool     `yaml:"compress"` // Compress logs using gzip
+	File       string   `yaml:"file"`        // Log file path
+	Level      LogLevel `yaml:"level"`       // Log Level
+	MaxDays    int      `yaml:"max_days"`    // Max days to rotate logs
+	MaxSizeMB  int      `yaml:"max_size_mb"` // Max megabytes of a log file before it is rotated
+	MaxBackups int      `yaml:"max_backups"` // Max rotated log files kept, 0 keeps all
+	Compress   bool     `yaml:"compress"`    // Compress logs using gzip
+	Sinks      LogSinks `yaml:"sinks"`       // Level and format of the console and the file
 }
 
 // DefaultLoggerConfig provides a basic default LogCfg.
 func DefaultLoggerConfig() LoggerConfig {
 	return LoggerConfig{
-		File:     "console",
-		Level:    DebugLevel,
-		MaxDays:  3,
-		Compress: false,
+		File:       "console",
+		Level:      DebugLevel,
+		MaxDays:    3,
+		MaxSizeMB:  100,
+		MaxBackups: 0,
+		Compress:   false,
+		Sinks: LogSinks{
+			Console: SinkConfig{Format: ColorFormat},
+			File:    SinkConfig{Format: JSONFormat},
+		},
 	}
 }
 
 // loggerInst is the application-wide logger instance.
 var (
-	loggerInst *Logger
+	loggerInst atomic.Pointer[Logger]
 	once       sync.Once
 )
 
 // RegisterLogger initializes the global logger.
 func RegisterLogger(cfg LoggerConfig) {
 	once.Do(func() {
-		loggerInst = buildLogger(cfg)
+		loggerInst.Store(buildLogger(cfg))
 	})
 }
 
 func Log() *Logger {
-	return loggerInst
+	return loggerInst.Load()
 }
 
 // Logger wraps zap.SugaredLogger to provide formatted logging capabilities.
 type Logger struct {
 	*zap.SugaredLogger
+	sinks *logSinks
+}
+
+// logSinks holds the live levels of the outputs of a Logger and the loggers derived from it.
+type logSinks struct {
+	cfg    LoggerConfig // Configuration the sinks were built from
+	levels map[string]zap.AtomicLevel
+	file   *lumberjack.Logger // nil when logging to console only
 }
 
 // buildLogger creates a new Logger instance.
 func buildLogger(cfg LoggerConfig) *Logger {
-	level := zapLevel(cfg.Level)
+	sinks := &logSinks{cfg: cfg, levels: make(map[string]zap.AtomicLevel)}
 
+	console := zap.NewAtomicLevelAt(zapLevel(sinkLevel(cfg.Sinks.Console, cfg.Level)))
+	sinks.levels[ConsoleSink] = console
 	cores := []zapcore.Core{
-		zapcore.NewCore(newConsoleEncoder(), newConsoleWriter(), level),
+		zapcore.NewCore(newEncoder(cfg.Sinks.Console.Format, ColorFormat), newConsoleWriter(), console),
 	}
 
 	if cfg.File != "console" {
-		fileWriter := newFileWriter(cfg)
-		cores = append(cores, zapcore.NewCore(newJSONEncoder(), fileWriter, level))
+		file := zap.NewAtomicLevelAt(zapLevel(sinkLevel(cfg.Sinks.File, cfg.Level)))
+		sinks.levels[FileSink] = file
+		sinks.file = newFileWriter(cfg)
+		cores = append(cores, zapcore.NewCore(newEncoder(cfg.Sinks.File.Format, JSONFormat), zapcore.AddSync(sinks.file), file))
 	}
 
 	combinedCore := zapcore.NewTee(cores...)
 	zapLogger := zap.New(combinedCore, zap.AddCaller(), zap.AddCallerSkip(1))
-	return &Logger{zapLogger.Sugar()}
+	return &Logger{zapLogger.Sugar(), sinks}
+}
+
+// sinkLevel returns the level of a sink, falling back to the global one.
+func sinkLevel(sink SinkConfig, global LogLevel) LogLevel {
+	if sink.Level != "" {
+		return sink.Level
+	}
+	return global
 }
 
 // zapLevel converts LogLevel to zap's logging level.
@@ -95,6 +175,21 @@ func zapLevel(level LogLevel) zapcore.Level {
 	}
 }
 
+// newEncoder prepares the encoder of a format, or of fallback if format is empty.
+func newEncoder(format, fallback LogFormat) zapcore.Encoder {
+	if format == "" {
+		format = fallback
+	}
+	switch format {
+	case JSONFormat:
+		return newJSONEncoder()
+	case TextFormat:
+		return newTextEncoder(zapcore.CapitalLevelEncoder)
+	default:
+		return newTextEncoder(zapcore.CapitalColorLevelEncoder)
+	}
+}
+
 // newJSONEncoder prepares the JSON encoder for the logger.
 func newJSONEncoder() zapcore.Encoder {
 	cfg := zapcore.EncoderConfig{
@@ -109,14 +204,14 @@ func newJSONEncoder() zapcore.Encoder {
 	return zapcore.NewJSONEncoder(cfg)
 }
 
-// newConsoleEncoder prepares the console encoder for the logger.
-func newConsoleEncoder() zapcore.Encoder {
+// newTextEncoder prepares the human-readable encoder for the logger.
+func newTextEncoder(level zapcore.LevelEncoder) zapcore.Encoder {
 	cfg := zapcore.EncoderConfig{
 		MessageKey:   "message",
 		LevelKey:     "level",
 		TimeKey:      "time",
 		CallerKey:    "caller",
-		EncodeLevel:  zapcore.CapitalColorLevelEncoder,
+		EncodeLevel:  level,
 		EncodeTime:   zapcore.TimeEncoderOfLayout("15:04:05.000"),
 		EncodeCaller: zapcore.ShortCallerEncoder,
 	}
@@ -124,12 +219,14 @@ func newConsoleEncoder() zapcore.Encoder {
 }
 
 // newFileWriter sets up Lumberjack as the file writer.
-func newFileWriter(cfg LoggerConfig) zapcore.WriteSyncer {
-	return zapcore.AddSync(&lumberjack.Logger{
-		Filename: cfg.File,
-		MaxAge:   cfg.MaxDays,
-		Compress: cfg.Compress,
-	})
+func newFileWriter(cfg LoggerConfig) *lumberjack.Logger {
+	return &lumberjack.Logger{
+		Filename:   cfg.File,
+		MaxAge:     cfg.MaxDays,
+		MaxSize:    cfg.MaxSizeMB,
+		MaxBackups: cfg.MaxBackups,
+		Compress:   cfg.Compress,
+	}
 }
 
 // newConsoleWriter returns a console writer.
@@ -162,12 +259,92 @@ func (l *Logger) Fatal(format string, a ...interface{}) {
 	l.SugaredLogger.Fatalf(format, a...)
 }
 
+// With returns a logger adding the given key-value pairs as structured fields to each entry.
+func (l *Logger) With(keysAndValues ...interface{}) *Logger {
+	return &Logger{l.SugaredLogger.With(keysAndValues...), l.sinks}
+}
+
+// SetLevel changes the level of a sink live, or of all sinks if sink is empty.
+// It also applies to the loggers derived with With.
+func (l *Logger) SetLevel(sink string, level LogLevel) error {
+	if !level.valid() {
+		return xerrors.Errorf("unknown log level %q", level)
+	}
+	if sink == "" {
+		for _, lvl := range l.sinks.levels {
+			lvl.SetLevel(zapLevel(level))
+		}
+		return nil
+	}
+	lvl, ok := l.sinks.levels[sink]
+	if !ok {
+		return xerrors.Errorf("unknown log sink %q", sink)
+	}
+	lvl.SetLevel(zapLevel(level))
+	return nil
+}
+
+// Levels returns the current level of each sink.
+func (l *Logger) Levels() map[string]LogLevel {
+	levels := make(map[string]LogLevel, len(l.sinks.levels))
+	for sink, lvl := range l.sinks.levels {
+		levels[sink] = LogLevel(lvl.Level().String())
+	}
+	return levels
+}
+
 // Sync flushes any buffered log entries.
 func (l *Logger) Sync() error {
 	return l.SugaredLogger.Sync()
 }
 
-// Update re-initializes the global logger with new configuration.
+// Update re-initializes the global logger with new configuration, flushing and closing the old one.
+// The old file is only closed once the new logger is installed, and is reopened by late writers.
+// It does nothing if l was built from cfg already. To only change levels, use SetLevel.
 func (l *Logger) Update(cfg LoggerConfig) {
-	loggerInst = buildLogger(cfg)
+	if cfg == l.sinks.cfg {
+		return
+	}
+	loggerInst.Store(buildLogger(cfg))
+	_ = l.Sync()
+	if l.sinks.file != nil {
+		_ = l.sinks.file.Close()
+	}
+}
+
+// SetLogLevel changes the level of a log sink live, or of all sinks if sink is empty,
+// recording it in the audit log. Logger.Levels reports the levels in effect, Config keeps the configured ones.
+func (b *Bot) SetLogLevel(ctx context.Context, sink string, level LogLevel) error {
+	err := Log().SetLevel(sink, level)
+	b.Audit.Record(ctx, "log_level", map[string]interface{}{"sink": sink, "level": level}, err)
+	return err
+}
+
+// logLevelCommand changes the log level.
+func logLevelCommand() *Command {
+	return &Command{
+		Name:  "loglevel",
+		Usage: "change the log level: loglevel <debug|info|warn|error|fatal> [console|file]",
+		Admin: true,
+		Handler: func(c *Context, args []string) {
+			if len(args) == 0 {
+				var levels []string
+				for sink, level := range Log().Levels() {
+					levels = append(levels, fmt.Sprintf("%s: %s", sink, level))
+				}
+				sort.Strings(levels)
+				c.SendText("Log levels: %s.", strings.Join(levels, ", "))
+				return
+			}
+			sink := ""
+			if len(args) > 1 {
+				sink = args[1]
+			}
+			if err := c.SetLogLevel(c, sink, LogLevel(args[0])); err != nil {
+				c.SendText("%s", err)
+				return
+			}
+			c.SendText("Log level set to %s.", args[0])
+		},
+	}
 }
@@ -0,0 +1,112 @@
+package core
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// lruCache is a size-bounded cache whose entries also expire after a TTL.
+// It is safe for concurrent use.
+type lruCache[K comparable, V any] struct {
+	mu    sync.Mutex
+	size  int
+	ttl   time.Duration
+	ll    *list.List
+	items map[K]*list.Element
+}
+
+type lruEntry[K comparable, V any] struct {
+	key     K
+	value   V
+	expires time.Time
+}
+
+// newLRUCache creates a cache holding at most size entries for at most ttl.
+// A non-positive ttl disables expiration.
+func newLRUCache[K comparable, V any](size int, ttl time.Duration) *lruCache[K, V] {
+	return &lruCache[K, V]{
+		size:  size,
+		ttl:   ttl,
+		ll:    list.New(),
+		items: make(map[K]*list.Element),
+	}
+}
+
+// Get returns the value of a live entry and marks it as recently used.
+func (c *lruCache[K, V]) Get(key K) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var zero V
+	el, ok := c.items[key]
+	if !ok {
+		return zero, false
+	}
+	entry := el.Value.(*lruEntry[K, V])
+	if c.expired(entry) {
+		c.remove(el)
+		return zero, false
+	}
+	c.ll.MoveToFront(el)
+	return entry.value, true
+}
+
+// Add inserts or replaces an entry and reports whether a live entry already existed.
+func (c *lruCache[K, V]) Add(key K, value V) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var expires time.Time
+	if c.ttl > 0 {
+		expires = time.Now().Add(c.ttl)
+	}
+
+	if el, ok := c.items[key]; ok {
+		entry := el.Value.(*lruEntry[K, V])
+		existed := !c.expired(entry)
+		entry.value, entry.expires = value, expires
+		c.ll.MoveToFront(el)
+		return existed
+	}
+
+	c.items[key] = c.ll.PushFront(&lruEntry[K, V]{key: key, value: value, expires: expires})
+	for c.size > 0 && c.ll.Len() > c.size {
+		c.remove(c.ll.Back())
+	}
+	return false
+}
+
+// Remove deletes an entry and returns its value if it was live.
+func (c *lruCache[K, V]) Remove(key K) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var zero V
+	el, ok := c.items[key]
+	if !ok {
+		return zero, false
+	}
+	entry := el.Value.(*lruEntry[K, V])
+	c.remove(el)
+	if c.expired(entry) {
+		return zero, false
+	}
+	return entry.value, true
+}
+
+// Len returns the number of entries, including expired ones not yet evicted.
+func (c *lruCache[K, V]) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ll.Len()
+}
+
+func (c *lruCache[K, V]) expired(entry *lruEntry[K, V]) bool {
+	return !entry.expires.IsZero() && time.Now().After(entry.expires)
+}
+
+func (c *lruCache[K, V]) remove(el *list.Element) {
+	c.ll.Remove(el)
+	delete(c.items, el.Value.(*lruEntry[K, V]).key)
+}
@@ -0,0 +1,152 @@
+package core
+
+import (
+	"bytes"
+	"errors"
+	"github.com/gabriel-vasile/mimetype"
+	"golang.org/x/xerrors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Size limits of media accepted by QQ.
+const (
+	MaxImageSize = 30 << 20 // 30 MiB
+	MaxVoiceSize = 10 << 20 // 10 MiB
+)
+
+var (
+	ErrMediaTooLarge = errors.New("media exceeds size limit")
+	ErrMediaType     = errors.New("unsupported media type")
+)
+
+// MediaTarget is the kind of chat an uploaded media is meant for.
+type MediaTarget string
+
+const (
+	FriendTarget MediaTarget = "friend"
+	GroupTarget  MediaTarget = "group"
+	TempTarget   MediaTarget = "temp"
+)
+
+// MediaSource provides the content of a media to upload.
+type MediaSource struct {
+	name string
+	read func(limit int64) ([]byte, error)
+}
+
+// MediaFile reads the media from a local file.
+func MediaFile(path string) MediaSource {
+	return MediaSource{
+		name: filepath.Base(path),
+		read: func(limit int64) ([]byte, error) {
+			info, err := os.Stat(path)
+			if err != nil {
+				return nil, err
+			}
+			if info.Size() > limit {
+				return nil, xerrors.Errorf("%s is %d bytes, limit is %d: %w", path, info.Size(), limit, ErrMediaTooLarge)
+			}
+			return os.ReadFile(path)
+		},
+	}
+}
+
+// MediaBytes uses b as the media content.
+func MediaBytes(b []byte) MediaSource {
+	return MediaSource{
+		read: func(limit int64) ([]byte, error) {
+			if int64(len(b)) > limit {
+				return nil, xerrors.Errorf("media is %d bytes, limit is %d: %w", len(b), limit, ErrMediaTooLarge)
+			}
+			return b, nil
+		},
+	}
+}
+
+// MediaReader reads the media from r until EOF.
+func MediaReader(r io.Reader) MediaSource {
+	return MediaSource{
+		read: func(limit int64) ([]byte, error) {
+			b, err := io.ReadAll(io.LimitReader(r, limit+1))
+			if err != nil {
+				return nil, err
+			}
+			if int64(len(b)) > limit {
+				return nil, xerrors.Errorf("media is over %d bytes: %w", limit, ErrMediaTooLarge)
+			}
+			return b, nil
+		},
+	}
+}
+
+// silkHeader is the magic of Tencent SILK audio, which mimetype can't detect.
+var silkHeader = []byte("#!SILK_V3")
+
+// load reads the media and checks its size and type.
+func (s MediaSource) load(limit int64, accept func(m *mimetype.MIME, b []byte) bool) (formFile, error) {
+	if s.read == nil {
+		return formFile{}, xerrors.New("empty media source")
+	}
+	b, err := s.read(limit)
+	if err != nil {
+		return formFile{}, xerrors.Errorf("read media: %w", err)
+	}
+	if len(b) == 0 {
+		return formFile{}, xerrors.Errorf("media is empty: %w", ErrMediaType)
+	}
+
+	m := mimetype.Detect(b)
+	if !accept(m, b) {
+		return formFile{}, xerrors.Errorf("%s: %w", m.String(), ErrMediaType)
+	}
+
+	name := s.name
+	if name == "" {
+		name = "media" + m.Extension()
+	}
+	return formFile{Name: name, MIME: m.String(), Contents: b}, nil
+}
+
+// UploadImage uploads an image and returns an Image component ready to be sent to target.
+func (c *Client) UploadImage(target MediaTarget, src MediaSource) (*Image, error) {
+	file, err := src.load(MaxImageSize, func(m *mimetype.MIME, _ []byte) bool {
+		return strings.HasPrefix(m.String(), "image/")
+	})
+	if err != nil {
+		return nil, err
+	}
+	file.Field = "img"
+
+	var resp struct {
+		ImageID string `json:"imageId"`
+		Url     string `json:"url"`
+	}
+	if err := c.upload("/uploadImage", map[string]string{"type": string(target)}, file, &resp); err != nil {
+		return nil, err
+	}
+	return &Image{Type: "Image", ImageID: resp.ImageID, Url: resp.Url}, nil
+}
+
+// UploadVoice uploads an AMR or SILK voice and returns a Voice component ready to be sent to target.
+func (c *Client) UploadVoice(target MediaTarget, src MediaSource) (*Voice, error) {
+	file, err := src.load(MaxVoiceSize, func(m *mimetype.MIME, b []byte) bool {
+		return strings.HasPrefix(m.String(), "audio/") ||
+			bytes.HasPrefix(bytes.TrimPrefix(b, []byte{0x02}), silkHeader)
+	})
+	if err != nil {
+		return nil, err
+	}
+	file.Field = "voice"
+
+	var resp struct {
+		VoiceID string `json:"voiceId"`
+		Url     string `json:"url"`
+	}
+	if err := c.upload("/uploadVoice", map[string]string{"type": string(target)}, file, &resp); err != nil {
+		return nil, err
+	}
+	return &Voice{Type: "Voice", VoiceID: resp.VoiceID, Url: resp.Url}, nil
+}
@@ -0,0 +1,190 @@
+package core
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"reflect"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Metrics holds the Prometheus series of a Bot, in a registry of its own.
+// A nil *Metrics records nothing.
+type Metrics struct {
+	Registry *prometheus.Registry
+
+	events        *prometheus.CounterVec
+	parseFailures prometheus.Counter
+	handlers      *prometheus.HistogramVec
+	apiCalls      *prometheus.CounterVec
+}
+
+// NewMetrics creates the series of b and registers them, along with the Go runtime and process collectors.
+func NewMetrics(b *Bot) *Metrics {
+	m := &Metrics{
+		Registry: prometheus.NewRegistry(),
+		events: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "koharu",
+			Name:      "events_received_total",
+			Help:      "Events received from mirai, by type.",
+		}, []string{"type"}),
+		parseFailures: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "koharu",
+			Name:      "event_parse_failures_total",
+			Help:      "Events received from mirai that could not be parsed.",
+		}),
+		handlers: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "koharu",
+			Name:      "handler_duration_seconds",
+			Help:      "Time spent in each middleware, excluding the middlewares it calls, by handler or plugin.",
+			Buckets:   []float64{.0005, .001, .005, .01, .05, .1, .5, 1, 5, 30},
+		}, []string{"handler"}),
+		apiCalls: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "koharu",
+			Name:      "api_calls_total",
+			Help:      "Calls to mirai-api-http, by endpoint and result code.",
+		}, []string{"endpoint", "code"}),
+	}
+
+	m.Registry.MustRegister(
+		m.events, m.parseFailures, m.handlers, m.apiCalls,
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: "koharu",
+			Name:      "bot_online",
+			Help:      "Whether the QQ account is online, according to mirai events.",
+		}, func() float64 {
+			if state, _ := b.Health.State(); state == StateOnline {
+				return 1
+			}
+			return 0
+		}),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: "koharu",
+			Name:      "dispatch_queue_depth",
+			Help:      "Events waiting in the dispatch queues.",
+		}, func() float64 {
+			return float64(b.Dispatcher.Stats().Queued)
+		}),
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Namespace: "koharu",
+			Name:      "dispatch_dropped_total",
+			Help:      "Events dropped because the dispatch queue was full.",
+		}, func() float64 {
+			return float64(b.Dispatcher.Stats().Dropped)
+		}),
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Namespace: "koharu",
+			Name:      "duplicate_events_total",
+			Help:      "Events dropped as duplicates.",
+		}, func() float64 {
+			if b.Deduplicator == nil {
+				return 0
+			}
+			return float64(b.Deduplicator.Dropped())
+		}),
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	return m
+}
+
+// Handler serves the metrics in the Prometheus text format.
+func (m *Metrics) Handler() gin.HandlerFunc {
+	h := promhttp.HandlerFor(m.Registry, promhttp.HandlerOpts{})
+	return func(gc *gin.Context) {
+		h.ServeHTTP(gc.Writer, gc.Request)
+	}
+}
+
+// observeEvent counts a received event.
+func (m *Metrics) observeEvent(e Event) {
+	if m == nil {
+		return
+	}
+	m.events.WithLabelValues(e.EventType()).Inc()
+}
+
+// observeParseFailure counts an event that could not be parsed.
+func (m *Metrics) observeParseFailure() {
+	if m == nil {
+		return
+	}
+	m.parseFailures.Inc()
+}
+
+// observeHandler records the time spent in a handler.
+func (m *Metrics) observeHandler(name string, d time.Duration) {
+	if m == nil {
+		return
+	}
+	m.handlers.WithLabelValues(name).Observe(d.Seconds())
+}
+
+// observeCall counts a call to mirai-api-http.
+func (m *Metrics) observeCall(endpoint, code string) {
+	if m == nil {
+		return
+	}
+	m.apiCalls.WithLabelValues(endpoint, code).Inc()
+}
+
+// handlerTiming tracks the handler running in a Context, to label its logs and metrics
+// and exclude the time of the handlers it calls through Next.
+type handlerTiming struct {
+	plugin string // Plugin the handler belongs to, if any
+	nested time.Duration
+}
+
+// timed runs a middleware, recording its duration when metrics are enabled.
+func (c *Context) timed(m Middleware) {
+	outer := c.timing
+	c.timing = handlerTiming{}
+	start := time.Now()
+	defer func() {
+		d := time.Since(start)
+		if c.Metrics != nil {
+			label := c.timing.plugin
+			if label == "" {
+				label = handlerName(m)
+			}
+			c.Metrics.observeHandler(label, d-c.timing.nested)
+		}
+		outer.nested += d
+		c.timing = outer
+	}()
+	c.invoke(m)
+}
+
+// handlerNames caches the names of middleware functions by code pointer.
+var handlerNames sync.Map
+
+// handlerName returns a short name of the function of m, e.g. "core.Commands".
+func handlerName(m Middleware) string {
+	pc := reflect.ValueOf(m).Pointer()
+	if name, ok := handlerNames.Load(pc); ok {
+		return name.(string)
+	}
+
+	name := "unknown"
+	if fn := runtime.FuncForPC(pc); fn != nil {
+		name = fn.Name()
+		name = name[strings.LastIndex(name, "/")+1:]
+		// closures returned by middleware constructors are named like core.Rx.func1
+		for i := strings.LastIndex(name, ".func"); i > 0; i = strings.LastIndex(name, ".func") {
+			name = name[:i]
+		}
+	}
+	handlerNames.Store(pc, name)
+	return name
+}
+
+// WithMetrics is a bot option to serve Prometheus metrics at /metrics.
+func WithMetrics() Option {
+	return func(b *Bot) {
+		b.withMetrics = true
+	}
+}
@@ -560,10 +560,14 @@ func (m MemberLeaveEventKick) EventType() string { return m.Type }
 type MemberLeaveEventQuit struct {
 	Type   string `json:"type"`
 	Member struct {
-		ID         int    `json:"id"`
-		MemberName string `json:"memberName"`
-		Permission string `json:"permission"`
-		Group      struct {
+		ID                 int    `json:"id"`
+		MemberName         string `json:"memberName"`
+		SpecialTitle       string `json:"specialTitle"`
+		Permission         string `json:"permission"`
+		JoinTimestamp      int    `json:"joinTimestamp"`
+		LastSpeakTimestamp int    `json:"lastSpeakTimestamp"`
+		MuteTimeRemaining  int    `json:"muteTimeRemaining"`
+		Group              struct {
 			ID         int    `json:"id"`
 			Name       string `json:"name"`
 			Permission string `json:"permission"`
@@ -600,10 +604,14 @@ type MemberSpecialTitleChangeEvent struct {
 	Origin  string `json:"origin"`
 	Current string `json:"current"`
 	Member  struct {
-		ID         int    `json:"id"`
-		MemberName string `json:"memberName"`
-		Permission string `json:"permission"`
-		Group      struct {
+		ID                 int    `json:"id"`
+		MemberName         string `json:"memberName"`
+		SpecialTitle       string `json:"specialTitle"`
+		Permission         string `json:"permission"`
+		JoinTimestamp      int    `json:"joinTimestamp"`
+		LastSpeakTimestamp int    `json:"lastSpeakTimestamp"`
+		MuteTimeRemaining  int    `json:"muteTimeRemaining"`
+		Group              struct {
 			ID         int    `json:"id"`
 			Name       string `json:"name"`
 			Permission string `json:"permission"`
@@ -618,10 +626,14 @@ type MemberPermissionChangeEvent struct {
 	Origin  string `json:"origin"`
 	Current string `json:"current"`
 	Member  struct {
-		ID         int    `json:"id"`
-		MemberName string `json:"memberName"`
-		Permission string `json:"permission"`
-		Group      struct {
+		ID                 int    `json:"id"`
+		MemberName         string `json:"memberName"`
+		SpecialTitle       string `json:"specialTitle"`
+		Permission         string `json:"permission"`
+		JoinTimestamp      int    `json:"joinTimestamp"`
+		LastSpeakTimestamp int    `json:"lastSpeakTimestamp"`
+		MuteTimeRemaining  int    `json:"muteTimeRemaining"`
+		Group              struct {
 			ID         int    `json:"id"`
 			Name       string `json:"name"`
 			Permission string `json:"permission"`
@@ -1061,42 +1073,42 @@ type Plain struct {
 func (p Plain) ComponentType() string { return p.Type }
 
 type Image struct {
-	Type      string      `json:"type"`
-	ImageID   string      `json:"imageId"`
-	Url       string      `json:"url"`
-	Path      interface{} `json:"path"`
-	Base64    interface{} `json:"base64"`
-	Width     int         `json:"width"`
-	Height    int         `json:"height"`
-	Size      int         `json:"size"`
-	ImageType string      `json:"imageType"`
-	IsEmoji   bool        `json:"isEmoji"`
+	Type      string `json:"type"`
+	ImageID   string `json:"imageId,omitempty"`
+	Url       string `json:"url,omitempty"`
+	Path      string `json:"path,omitempty"`
+	Base64    string `json:"base64,omitempty"`
+	Width     int    `json:"width"`
+	Height    int    `json:"height"`
+	Size      int    `json:"size"`
+	ImageType string `json:"imageType"`
+	IsEmoji   bool   `json:"isEmoji"`
 }
 
 func (i Image) ComponentType() string { return i.Type }
 
 type FlashImage struct {
-	Type      string      `json:"type"`
-	ImageID   string      `json:"imageId"`
-	Url       string      `json:"url"`
-	Path      interface{} `json:"path"`
-	Base64    interface{} `json:"base64"`
-	Width     int         `json:"width"`
-	Height    int         `json:"height"`
-	Size      int         `json:"size"`
-	ImageType string      `json:"imageType"`
-	IsEmoji   bool        `json:"isEmoji"`
+	Type      string `json:"type"`
+	ImageID   string `json:"imageId,omitempty"`
+	Url       string `json:"url,omitempty"`
+	Path      string `json:"path,omitempty"`
+	Base64    string `json:"base64,omitempty"`
+	Width     int    `json:"width"`
+	Height    int    `json:"height"`
+	Size      int    `json:"size"`
+	ImageType string `json:"imageType"`
+	IsEmoji   bool   `json:"isEmoji"`
 }
 
 func (f FlashImage) ComponentType() string { return f.Type }
 
 type Voice struct {
-	Type    string      `json:"type"`
-	VoiceID string      `json:"voiceId"`
-	Url     string      `json:"url"`
-	Path    interface{} `json:"path"`
-	Base64  interface{} `json:"base64"`
-	Length  int         `json:"length"`
+	Type    string `json:"type"`
+	VoiceID string `json:"voiceId,omitempty"`
+	Url     string `json:"url,omitempty"`
+	Path    string `json:"path,omitempty"`
+	Base64  string `json:"base64,omitempty"`
+	Length  int    `json:"length"`
 }
 
 func (v Voice) ComponentType() string { return v.Type }
@@ -0,0 +1,275 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// update rewrites the golden files from the current parser: go test ./core -run Golden -update
+var update = flag.Bool("update", false, "update golden files")
+
+// fixtures returns the JSON fixtures of testdata/dir by type name.
+func fixtures(t *testing.T, dir string) map[string][]byte {
+	t.Helper()
+	paths, err := filepath.Glob(filepath.Join("testdata", dir, "*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fs := make(map[string][]byte, len(paths))
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fs[strings.TrimSuffix(filepath.Base(path), ".json")] = data
+	}
+	return fs
+}
+
+// parsedTypes returns the type names matched by the switch of a function of mirai.go.
+func parsedTypes(t *testing.T, fn string) []string {
+	t.Helper()
+	f, err := parser.ParseFile(token.NewFileSet(), "mirai.go", nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var types []string
+	for _, decl := range f.Decls {
+		d, ok := decl.(*ast.FuncDecl)
+		if !ok || d.Name.Name != fn {
+			continue
+		}
+		ast.Inspect(d.Body, func(n ast.Node) bool {
+			if cc, ok := n.(*ast.CaseClause); ok {
+				for _, e := range cc.List {
+					if lit, ok := e.(*ast.BasicLit); ok && lit.Kind == token.STRING {
+						name, _ := strconv.Unquote(lit.Value)
+						types = append(types, name)
+					}
+				}
+			}
+			return true
+		})
+	}
+	if len(types) == 0 {
+		t.Fatalf("no types found in %s", fn)
+	}
+	return types
+}
+
+func TestFixturesCoverAllTypes(t *testing.T) {
+	for dir, fn := range map[string]string{"events": "ParseEvent", "components": "UnmarshalJSON"} {
+		fs := fixtures(t, dir)
+		for _, name := range parsedTypes(t, fn) {
+			if _, ok := fs[name]; !ok {
+				t.Errorf("%s is parsed by %s but has no fixture in testdata/%s", name, fn, dir)
+			}
+		}
+	}
+}
+
+func TestParseEventGolden(t *testing.T) {
+	for name, data := range fixtures(t, "events") {
+		t.Run(name, func(t *testing.T) {
+			e, err := ParseEvent(data)
+			if err != nil {
+				t.Fatalf("parse: %s", err)
+			}
+			if e.EventType() != name {
+				t.Errorf("EventType() = %q, want %q", e.EventType(), name)
+			}
+			golden(t, filepath.Join("testdata", "events", name+".golden"), dump(e))
+		})
+	}
+}
+
+func TestParseComponentGolden(t *testing.T) {
+	for name, data := range fixtures(t, "components") {
+		t.Run(name, func(t *testing.T) {
+			chain := parseComponent(t, data)
+			if chain[0].ComponentType() != name {
+				t.Errorf("ComponentType() = %q, want %q", chain[0].ComponentType(), name)
+			}
+			golden(t, filepath.Join("testdata", "components", name+".golden"), dump(chain[0]))
+		})
+	}
+}
+
+func TestEventRoundTrip(t *testing.T) {
+	for name, data := range fixtures(t, "events") {
+		t.Run(name, func(t *testing.T) {
+			e, err := ParseEvent(data)
+			if err != nil {
+				t.Fatalf("parse: %s", err)
+			}
+			sameJSON(t, data, e)
+		})
+	}
+}
+
+func TestComponentRoundTrip(t *testing.T) {
+	for name, data := range fixtures(t, "components") {
+		t.Run(name, func(t *testing.T) {
+			sameJSON(t, data, parseComponent(t, data)[0])
+		})
+	}
+}
+
+// parseComponent parses a single component through MessageChain.
+func parseComponent(t *testing.T, data []byte) MessageChain {
+	t.Helper()
+	var chain MessageChain
+	if err := json.Unmarshal(append(append([]byte("["), data...), ']'), &chain); err != nil {
+		t.Fatalf("parse: %s", err)
+	}
+	if len(chain) != 1 {
+		t.Fatalf("parsed %d components, want 1", len(chain))
+	}
+	return chain
+}
+
+// sameJSON checks that v encodes to the same JSON as want. Nulls are ignored as mirai sends them
+// for absent optional fields, which encode back as omitted or zero values.
+func sameJSON(t *testing.T, want []byte, v interface{}) {
+	t.Helper()
+	got, err := json.Marshal(v)
+	if err != nil {
+		t.Fatalf("encode: %s", err)
+	}
+	var w, g interface{}
+	if err := json.Unmarshal(want, &w); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(got, &g); err != nil {
+		t.Fatal(err)
+	}
+	if w, g := dropNulls(w), dropNulls(g); !reflect.DeepEqual(w, g) {
+		wj, _ := json.MarshalIndent(w, "", "  ")
+		gj, _ := json.MarshalIndent(g, "", "  ")
+		t.Errorf("round trip changed the JSON\nwant: %s\ngot:  %s", wj, gj)
+	}
+}
+
+func dropNulls(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, x := range v {
+			if x == nil {
+				delete(v, k)
+			} else {
+				v[k] = dropNulls(x)
+			}
+		}
+	case []interface{}:
+		for i, x := range v {
+			v[i] = dropNulls(x)
+		}
+	}
+	return v
+}
+
+// golden compares got to the golden file at path, or rewrites it with -update.
+func golden(t *testing.T, path, got string) {
+	t.Helper()
+	if *update {
+		if err := os.WriteFile(path, []byte(got), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%s, run with -update to create it", err)
+	}
+	if !bytes.Equal(want, []byte(got)) {
+		t.Errorf("%s differs, run with -update if the change is intended\nwant:\n%s\ngot:\n%s", path, want, got)
+	}
+}
+
+// dump lists the fields of v with their Go names and types, one per line,
+// so that goldens show what the parser typed rather than what it was given.
+func dump(v interface{}) string {
+	var sb strings.Builder
+	dumpValue(&sb, "", reflect.ValueOf(v))
+	return sb.String()
+}
+
+func dumpValue(sb *strings.Builder, path string, v reflect.Value) {
+	line := func(format string, a ...interface{}) {
+		if path == "" {
+			fmt.Fprintf(sb, format+"\n", a...)
+			return
+		}
+		fmt.Fprintf(sb, "%s "+format+"\n", append([]interface{}{path}, a...)...)
+	}
+
+	switch v.Kind() {
+	case reflect.Invalid:
+		line("= nil")
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			line("= nil (%s)", typeName(v.Type()))
+			return
+		}
+		if v.Kind() == reflect.Ptr {
+			line("(%s)", typeName(v.Type()))
+		}
+		dumpValue(sb, path, v.Elem())
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			dumpValue(sb, join(path, v.Type().Field(i).Name), v.Field(i))
+		}
+	case reflect.Slice:
+		if v.IsNil() {
+			line("= nil (%s)", typeName(v.Type()))
+			return
+		}
+		line("(%s, len %d)", typeName(v.Type()), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			dumpValue(sb, fmt.Sprintf("%s[%d]", path, i), v.Index(i))
+		}
+	case reflect.Map:
+		line("(%s, len %d)", typeName(v.Type()), v.Len())
+		keys := v.MapKeys()
+		sort.Slice(keys, func(i, j int) bool { return fmt.Sprint(keys[i]) < fmt.Sprint(keys[j]) })
+		for _, k := range keys {
+			dumpValue(sb, fmt.Sprintf("%s[%q]", path, fmt.Sprint(k)), v.MapIndex(k))
+		}
+	case reflect.Float32, reflect.Float64:
+		line("= %s (%s)", strconv.FormatFloat(v.Float(), 'f', -1, 64), v.Type())
+	default:
+		line("= %#v", v.Interface())
+	}
+}
+
+// typeName names t, shortening the anonymous structs of mirai.go to "struct".
+func typeName(t reflect.Type) string {
+	switch {
+	case t.Name() != "":
+		return t.String()
+	case t.Kind() == reflect.Struct:
+		return "struct"
+	case t.Kind() == reflect.Slice:
+		return "[]" + typeName(t.Elem())
+	}
+	return t.String()
+}
+
+func join(path, field string) string {
+	if path == "" {
+		return field
+	}
+	return path + "." + field
+}
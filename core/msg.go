@@ -1,4 +1,85 @@
-// TODO: Abstract interfaces for events that will be needed,
-// TODO: so that supporting a specific protocol only requires implementing the interface.
-
 package core
+
+import (
+	"fmt"
+	"golang.org/x/xerrors"
+	"strings"
+)
+
+// Text builds a message chain made of a single formatted Plain.
+func Text(format string, a ...interface{}) MessageChain {
+	return MessageChain{&Plain{Type: "Plain", Text: fmt.Sprintf(format, a...)}}
+}
+
+// PlainText concatenates the text of all Plain components of the chain.
+func (chain MessageChain) PlainText() string {
+	var sb strings.Builder
+	for _, comp := range chain {
+		if p, ok := comp.(*Plain); ok {
+			sb.WriteString(p.Text)
+		}
+	}
+	return sb.String()
+}
+
+// Quote returns the Quote component of the chain, if any.
+func (chain MessageChain) Quote() *Quote {
+	for _, comp := range chain {
+		if q, ok := comp.(*Quote); ok {
+			return q
+		}
+	}
+	return nil
+}
+
+// SendFriendMessage sends chain to a friend and returns the message ID.
+func (c *Client) SendFriendMessage(target int, chain MessageChain) (int, error) {
+	return c.sendMessage("/sendFriendMessage", map[string]interface{}{"target": target, "messageChain": chain})
+}
+
+// SendGroupMessage sends chain to a group and returns the message ID.
+func (c *Client) SendGroupMessage(target int, chain MessageChain) (int, error) {
+	return c.sendMessage("/sendGroupMessage", map[string]interface{}{"target": target, "messageChain": chain})
+}
+
+// SendTempMessage sends chain to a group member in a temp chat and returns the message ID.
+func (c *Client) SendTempMessage(group, member int, chain MessageChain) (int, error) {
+	return c.sendMessage("/sendTempMessage", map[string]interface{}{"group": group, "qq": member, "messageChain": chain})
+}
+
+// SendMessage sends chain to the given chat and returns the message ID.
+func (c *Client) SendMessage(s Subject, chain MessageChain) (int, error) {
+	return c.SendQuote(s, 0, chain)
+}
+
+// SendQuote sends chain to the given chat as a reply to the message quote, and returns the message ID.
+// A zero quote sends a plain message.
+func (c *Client) SendQuote(s Subject, quote int, chain MessageChain) (int, error) {
+	var endpoint string
+	req := map[string]interface{}{"messageChain": chain}
+	switch s.Kind {
+	case FriendSubject, StrangerSubject:
+		endpoint, req["target"] = "/sendFriendMessage", s.ID
+	case GroupSubject:
+		endpoint, req["target"] = "/sendGroupMessage", s.ID
+	case TempSubject:
+		endpoint, req["group"], req["qq"] = "/sendTempMessage", s.Group, s.ID
+	default:
+		return 0, xerrors.Errorf("unknown subject kind: %s", s.Kind)
+	}
+	if quote != 0 {
+		req["quote"] = quote
+	}
+	return c.sendMessage(endpoint, req)
+}
+
+// sendMessage calls one of the send endpoints.
+func (c *Client) sendMessage(endpoint string, req map[string]interface{}) (int, error) {
+	var resp struct {
+		MessageID int `json:"messageId"`
+	}
+	if err := c.Post(endpoint, req, &resp); err != nil {
+		return 0, err
+	}
+	return resp.MessageID, nil
+}
@@ -0,0 +1,292 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"golang.org/x/xerrors"
+	"strings"
+	"sync"
+)
+
+// Plugin is a bot feature with its own lifecycle.
+//
+// Init is called once with the Bot on every plugin before any plugin starts, then Start,
+// both in dependency order. The middlewares and commands of a plugin are registered only if both succeed.
+// Stop is called in reverse order when the bot shuts down.
+type Plugin interface {
+	Name() string
+	Version() string
+	Init(b *Bot) error
+	Start() error
+	Stop() error
+	Middlewares() []Middleware
+	Commands() []*Command
+}
+
+// Dependent is implemented by plugins that must start after other plugins.
+type Dependent interface {
+	Dependencies() []string
+}
+
+// PluginState is the lifecycle state of a plugin.
+type PluginState string
+
+const (
+	PluginLoaded  PluginState = "loaded"
+	PluginRunning PluginState = "running"
+	PluginStopped PluginState = "stopped"
+	PluginFailed  PluginState = "failed"
+)
+
+// PluginStatus describes a registered plugin.
+type PluginStatus struct {
+	Name    string      `json:"name"`
+	Version string      `json:"version"`
+	State   PluginState `json:"state"`
+	Error   string      `json:"error,omitempty"`
+}
+
+type pluginEntry struct {
+	Plugin
+	state PluginState
+	err   error
+}
+
+// plugins is the registry of the plugins of a Bot.
+type plugins struct {
+	mu      sync.RWMutex
+	entries []*pluginEntry
+	started []*pluginEntry
+}
+
+// Plug registers plugins. It must be called before Run.
+func (b *Bot) Plug(ps ...Plugin) {
+	b.plugins.mu.Lock()
+	defer b.plugins.mu.Unlock()
+	for _, p := range ps {
+		b.plugins.entries = append(b.plugins.entries, &pluginEntry{Plugin: p, state: PluginLoaded})
+	}
+}
+
+// WithPlugins is a bot option to register plugins.
+func WithPlugins(ps ...Plugin) Option {
+	return func(b *Bot) {
+		b.Plug(ps...)
+	}
+}
+
+// Plugins returns the status of all registered plugins.
+func (b *Bot) Plugins() []PluginStatus {
+	b.plugins.mu.RLock()
+	defer b.plugins.mu.RUnlock()
+	status := make([]PluginStatus, 0, len(b.plugins.entries))
+	for _, e := range b.plugins.entries {
+		s := PluginStatus{Name: e.Name(), Version: e.Version(), State: e.state}
+		if e.err != nil {
+			s.Error = e.err.Error()
+		}
+		status = append(status, s)
+	}
+	return status
+}
+
+// pluginOrder sorts plugins so that dependencies come first.
+// Plugins with duplicate names, missing dependencies or dependency cycles are marked as failed.
+func pluginOrder(entries []*pluginEntry) []*pluginEntry {
+	byName := make(map[string]*pluginEntry, len(entries))
+	for _, e := range entries {
+		if _, ok := byName[e.Name()]; ok {
+			e.state, e.err = PluginFailed, xerrors.Errorf("duplicate plugin name %s", e.Name())
+			continue
+		}
+		byName[e.Name()] = e
+	}
+
+	const (
+		unvisited = iota
+		visiting
+		done
+	)
+	marks := make(map[*pluginEntry]int, len(entries))
+	order := make([]*pluginEntry, 0, len(entries))
+
+	var visit func(e *pluginEntry) error
+	visit = func(e *pluginEntry) error {
+		switch marks[e] {
+		case visiting:
+			return xerrors.Errorf("dependency cycle through %s", e.Name())
+		case done:
+			if e.state == PluginFailed {
+				return xerrors.Errorf("dependency %s failed", e.Name())
+			}
+			return nil
+		}
+		marks[e] = visiting
+		defer func() { marks[e] = done }()
+
+		if d, ok := e.Plugin.(Dependent); ok {
+			for _, name := range d.Dependencies() {
+				dep, ok := byName[name]
+				if !ok {
+					e.state, e.err = PluginFailed, xerrors.Errorf("missing dependency %s", name)
+					return e.err
+				}
+				if err := visit(dep); err != nil {
+					e.state, e.err = PluginFailed, xerrors.Errorf("dependency %s: %w", name, err)
+					return e.err
+				}
+			}
+		}
+		order = append(order, e)
+		return nil
+	}
+
+	for _, e := range entries {
+		if e.state != PluginFailed {
+			_ = visit(e)
+		}
+	}
+	return order
+}
+
+// safeCall runs fn, turning a panic into an error.
+func safeCall(fn func() error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return fn()
+}
+
+// startPlugins initializes all plugins, then starts them, in dependency order, and registers their handlers.
+// A plugin failing, or depending on a failed plugin, is disabled without affecting the others.
+func (b *Bot) startPlugins() {
+	b.plugins.mu.Lock()
+	defer b.plugins.mu.Unlock()
+
+	order := pluginOrder(b.plugins.entries)
+	for _, e := range order {
+		if e.state == PluginFailed {
+			Log().Error("Plugin %s disabled: %s", e.Name(), e.err)
+			continue
+		}
+		if !b.startable(e) {
+			continue
+		}
+		if err := safeCall(func() error { return e.Init(b) }); err != nil {
+			e.state, e.err = PluginFailed, xerrors.Errorf("init: %w", err)
+			Log().Error("Plugin %s disabled: %s", e.Name(), e.err)
+		}
+	}
+
+	for _, e := range order {
+		if !b.startable(e) {
+			continue
+		}
+		if err := safeCall(e.Start); err != nil {
+			e.state, e.err = PluginFailed, xerrors.Errorf("start: %w", err)
+			Log().Error("Plugin %s disabled: %s", e.Name(), e.err)
+			continue
+		}
+
+		for _, m := range e.Middlewares() {
+			b.Middlewares = append(b.Middlewares, pluginMiddleware(e.Name(), m))
+		}
+		for _, cmd := range e.Commands() {
+			cmd.plugin = e.Name()
+			b.Command(cmd)
+		}
+		e.state = PluginRunning
+		b.plugins.started = append(b.plugins.started, e)
+		Log().Info("Plugin %s %s started.", e.Name(), e.Version())
+	}
+}
+
+// startable reports whether e can go on starting, disabling it if a dependency failed.
+// The caller must hold the lock.
+func (b *Bot) startable(e *pluginEntry) bool {
+	if e.state == PluginFailed {
+		return false
+	}
+	if failed := b.failedDependency(e); failed != "" {
+		e.state, e.err = PluginFailed, xerrors.Errorf("dependency %s failed", failed)
+		Log().Error("Plugin %s disabled: %s", e.Name(), e.err)
+		return false
+	}
+	return true
+}
+
+// failedDependency returns the name of a failed dependency of e, if any. The caller must hold the lock.
+func (b *Bot) failedDependency(e *pluginEntry) string {
+	d, ok := e.Plugin.(Dependent)
+	if !ok {
+		return ""
+	}
+	for _, name := range d.Dependencies() {
+		for _, other := range b.plugins.entries {
+			if other.Name() == name && other.state == PluginFailed {
+				return name
+			}
+		}
+	}
+	return ""
+}
+
+// stopPlugins stops the started plugins in reverse order until ctx is done.
+// The lock is only held to update states, so a plugin slow to stop doesn't block the others' readers.
+func (b *Bot) stopPlugins(ctx context.Context) error {
+	b.plugins.mu.Lock()
+	started := b.plugins.started
+	b.plugins.started = nil
+	b.plugins.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := len(started) - 1; i >= 0; i-- {
+			e := started[i]
+			err := safeCall(e.Stop)
+			if err != nil {
+				Log().Error("Plugin %s failed to stop: %s", e.Name(), err)
+			}
+			b.plugins.mu.Lock()
+			if err != nil {
+				e.err = xerrors.Errorf("stop: %w", err)
+			}
+			e.state = PluginStopped
+			b.plugins.mu.Unlock()
+		}
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// pluginsCommand lists the registered plugins.
+func pluginsCommand() *Command {
+	return &Command{
+		Name:  "plugins",
+		Usage: "list plugins and their state",
+		Admin: true,
+		Handler: func(c *Context, args []string) {
+			var sb strings.Builder
+			for _, s := range c.Plugins() {
+				fmt.Fprintf(&sb, "%s %s: %s", s.Name, s.Version, s.State)
+				if s.Error != "" {
+					fmt.Fprintf(&sb, " (%s)", s.Error)
+				}
+				sb.WriteString("\n")
+			}
+			if sb.Len() == 0 {
+				sb.WriteString("No plugins.")
+			}
+			if _, err := c.SendText("%s", strings.TrimSuffix(sb.String(), "\n")); err != nil {
+				c.Log().Error("Failed to send plugin list: %s", err)
+			}
+		},
+	}
+}
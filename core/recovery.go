@@ -0,0 +1,115 @@
+package core
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+// RecoveryConfig holds the settings of Recovery.
+type RecoveryConfig struct {
+	Notify   bool `yaml:"notify"`   // Send panic reports to bot admins
+	Interval int  `yaml:"interval"` // Min seconds between two reports
+}
+
+// DefaultRecoveryConfig provides a basic default RecoveryConfig.
+func DefaultRecoveryConfig() RecoveryConfig {
+	return RecoveryConfig{
+		Notify:   false,
+		Interval: 300,
+	}
+}
+
+// panicReporter rate-limits the panic reports sent to admins.
+type panicReporter struct {
+	mu         sync.Mutex
+	last       time.Time
+	suppressed int
+}
+
+// allow reports whether a report may be sent now, and how many were suppressed since the last one.
+func (r *panicReporter) allow(interval time.Duration) (bool, int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if time.Since(r.last) < interval {
+		r.suppressed++
+		return false, 0
+	}
+	suppressed := r.suppressed
+	r.last, r.suppressed = time.Now(), 0
+	return true, suppressed
+}
+
+// Recovery recovers from panics in each of the following middlewares, so that a panicking
+// handler doesn't prevent the others from running. Panics are logged with their stack and,
+// if RecoveryConfig.Notify is set, reported to bot admins.
+func Recovery() Middleware {
+	return func(c *Context) {
+		c.onPanic = reportPanic
+		c.Next()
+	}
+}
+
+// reportPanic logs a recovered panic and notifies admins.
+func reportPanic(c *Context, r interface{}) {
+	where := "no event"
+	if c.Event != nil {
+		where = c.Event.EventType()
+		if s, ok := SubjectOf(c.Event); ok {
+			where += fmt.Sprintf(" in %s %d", s.Kind, s.ID)
+		}
+		if e, ok := c.Event.(MessageEvent); ok {
+			where += fmt.Sprintf(" from %d", e.SenderID())
+		}
+	}
+	c.Log().Error("Recovered from panic handling %s: %v\n%s", where, r, debug.Stack())
+
+	cfg := c.Config.Recovery
+	if !cfg.Notify || len(c.Config.Admin) == 0 {
+		return
+	}
+	ok, suppressed := c.panics.allow(time.Duration(cfg.Interval) * time.Second)
+	if !ok {
+		return
+	}
+
+	text := Text("[Panic] handling %s: %v", where, r)
+	if suppressed > 0 {
+		text = Text("[Panic] handling %s: %v\n(%d more since the last report)", where, r, suppressed)
+	}
+	c.Go(func(c *Context) {
+		for _, admin := range c.Config.Admin {
+			if _, err := c.SendFriendMessage(admin, text); err != nil {
+				c.Log().Error("Failed to report panic to admin %d: %s", admin, err)
+			}
+		}
+	})
+}
+
+// invoke runs a middleware, recovering from its panics when Recovery is in the chain.
+func (c *Context) invoke(m Middleware) {
+	if c.onPanic != nil {
+		defer func() {
+			if r := recover(); r != nil {
+				c.onPanic(c, r)
+			}
+		}()
+	}
+	m(c)
+}
+
+// recoverHTTP recovers from panics of HTTP handlers, logging them through Log().
+func recoverHTTP() gin.HandlerFunc {
+	return func(gc *gin.Context) {
+		defer func() {
+			if r := recover(); r != nil {
+				Log().Error("Recovered from panic serving %s %s: %v\n%s", gc.Request.Method, gc.Request.URL.Path, r, debug.Stack())
+				gc.AbortWithStatus(http.StatusInternalServerError)
+			}
+		}()
+		gc.Next()
+	}
+}
@@ -0,0 +1,263 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"golang.org/x/xerrors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RequestAction is how the bot answers a request event.
+type RequestAction int
+
+const (
+	RequestAccept RequestAction = iota
+	RequestReject
+	RequestIgnore
+)
+
+var ErrUnsupportedAction = errors.New("action not supported by this request")
+
+// RequestConfig defines how incoming requests are handled, see RequestPolicy.
+type RequestConfig struct {
+	AcceptAdminInvite bool  `yaml:"accept_admin_invite"` // Accept group invites from bot admins
+	Blacklist         []int `yaml:"blacklist"`           // Reject any request from these users
+	ForwardToAdmin    bool  `yaml:"forward_to_admin"`    // Forward other requests to bot admins
+	Pending           int   `yaml:"pending"`             // Max forwarded requests awaiting an answer, the oldest are dropped
+	Expire            int   `yaml:"expire"`              // Hours a forwarded request can be answered
+}
+
+// DefaultRequestConfig provides a basic default RequestConfig.
+func DefaultRequestConfig() RequestConfig {
+	return RequestConfig{
+		AcceptAdminInvite: true,
+		Blacklist:         []int{},
+		ForwardToAdmin:    true,
+		Pending:           100,
+		Expire:            72,
+	}
+}
+
+// blacklisted reports whether requests from id are rejected.
+func (cfg RequestConfig) blacklisted(id int) bool {
+	for _, b := range cfg.Blacklist {
+		if b == id {
+			return true
+		}
+	}
+	return false
+}
+
+// RespondRequest answers a request event with the given action and message.
+// When blacklist is set, further requests from the same user are blocked by QQ.
+func (c *Client) RespondRequest(e RequestEvent, action RequestAction, blacklist bool, msg string) error {
+	var endpoint string
+	operate := -1
+
+	switch e.EventType() {
+	case "NewFriendRequestEvent":
+		endpoint = "/resp/newFriendRequestEvent"
+		switch {
+		case action == RequestAccept && !blacklist:
+			operate = 0
+		case action == RequestReject && !blacklist:
+			operate = 1
+		case action == RequestReject && blacklist:
+			operate = 2
+		}
+	case "MemberJoinRequestEvent":
+		endpoint = "/resp/memberJoinRequestEvent"
+		switch {
+		case action == RequestAccept && !blacklist:
+			operate = 0
+		case action == RequestReject && !blacklist:
+			operate = 1
+		case action == RequestIgnore && !blacklist:
+			operate = 2
+		case action == RequestReject && blacklist:
+			operate = 3
+		case action == RequestIgnore && blacklist:
+			operate = 4
+		}
+	case "BotInvitedJoinGroupRequestEvent":
+		endpoint = "/resp/botInvitedJoinGroupRequestEvent"
+		switch {
+		case action == RequestAccept && !blacklist:
+			operate = 0
+		case action == RequestReject && !blacklist:
+			operate = 1
+		}
+	default:
+		return xerrors.Errorf("%s: %w", e.EventType(), ErrUnsupportedAction)
+	}
+	if operate < 0 {
+		return xerrors.Errorf("%s (action %d, blacklist %t): %w", e.EventType(), action, blacklist, ErrUnsupportedAction)
+	}
+
+	eventID, fromID, groupID := e.RequestIDs()
+	return c.Post(endpoint, map[string]interface{}{
+		"eventId": eventID,
+		"fromId":  fromID,
+		"groupId": groupID,
+		"operate": operate,
+		"message": msg,
+	}, nil)
+}
+
+// requestEvent returns the current event as a RequestEvent.
+func (c *Context) requestEvent() (RequestEvent, error) {
+	e, ok := c.Event.(RequestEvent)
+	if !ok {
+		return nil, xerrors.Errorf("%s is not a request event", c.Event.EventType())
+	}
+	return e, nil
+}
+
+// AcceptRequest accepts the current request event.
+func (c *Context) AcceptRequest(msg string) error {
+	e, err := c.requestEvent()
+	if err != nil {
+		return err
+	}
+	return c.RespondRequest(e, RequestAccept, false, msg)
+}
+
+// RejectRequest rejects the current request event, optionally blacklisting the requester.
+func (c *Context) RejectRequest(msg string, blacklist bool) error {
+	e, err := c.requestEvent()
+	if err != nil {
+		return err
+	}
+	return c.RespondRequest(e, RequestReject, blacklist, msg)
+}
+
+// IgnoreRequest ignores the current request event, optionally blacklisting the requester.
+func (c *Context) IgnoreRequest(msg string, blacklist bool) error {
+	e, err := c.requestEvent()
+	if err != nil {
+		return err
+	}
+	return c.RespondRequest(e, RequestIgnore, blacklist, msg)
+}
+
+// pendingRequests holds the requests forwarded to admins, keyed by event ID.
+// Requests left unanswered expire, and the oldest are dropped once RequestConfig.Pending are waiting.
+type pendingRequests struct {
+	cache *lruCache[int, RequestEvent]
+}
+
+func newPendingRequests(cfg RequestConfig) *pendingRequests {
+	return &pendingRequests{cache: newLRUCache[int, RequestEvent](cfg.Pending, time.Duration(cfg.Expire)*time.Hour)}
+}
+
+func (p *pendingRequests) add(e RequestEvent) {
+	id, _, _ := e.RequestIDs()
+	p.cache.Add(id, e)
+}
+
+// take removes and returns a pending request.
+func (p *pendingRequests) take(id int) (RequestEvent, bool) {
+	return p.cache.Remove(id)
+}
+
+// describeRequest formats a request for admins.
+func describeRequest(e RequestEvent) string {
+	switch e := e.(type) {
+	case *NewFriendRequestEvent:
+		return fmt.Sprintf("%s(%d) wants to be friends: %s", e.Nick, e.FromID, e.Message)
+	case *MemberJoinRequestEvent:
+		return fmt.Sprintf("%s(%d) wants to join %s(%d): %s", e.Nick, e.FromID, e.GroupName, e.GroupID, e.Message)
+	case *BotInvitedJoinGroupRequestEvent:
+		return fmt.Sprintf("%s(%d) invites the bot to %s(%d): %s", e.Nick, e.FromID, e.GroupName, e.GroupID, e.Message)
+	default:
+		return e.EventType()
+	}
+}
+
+// RequestPolicy applies RequestConfig to request events:
+// requests from blacklisted users are rejected, group invites from admins are accepted,
+// and the rest is forwarded to admins who answer with the accept, reject and ignore commands.
+func RequestPolicy() Middleware {
+	return func(c *Context) {
+		e, ok := c.Event.(RequestEvent)
+		if !ok {
+			c.Next()
+			return
+		}
+
+		cfg := c.Config.Request
+		eventID, fromID, _ := e.RequestIDs()
+		switch {
+		case cfg.blacklisted(fromID):
+			if err := c.RespondRequest(e, RequestReject, false, ""); err != nil {
+				c.Log().Error("Failed to reject request #%d from blacklisted %d: %s", eventID, fromID, err)
+			} else {
+				c.Log().Info("Rejected request #%d from blacklisted %d", eventID, fromID)
+			}
+			c.Abort()
+			return
+		case e.EventType() == "BotInvitedJoinGroupRequestEvent" && cfg.AcceptAdminInvite && c.IsAdmin(fromID):
+			if err := c.RespondRequest(e, RequestAccept, false, ""); err != nil {
+				c.Log().Error("Failed to accept invite #%d from admin %d: %s", eventID, fromID, err)
+			} else {
+				c.Log().Info("Accepted invite #%d from admin %d", eventID, fromID)
+			}
+			c.Abort()
+			return
+		case cfg.ForwardToAdmin && len(c.Config.Admin) > 0:
+			c.requests.add(e)
+			p := c.Config.Command.Prefix
+			text := Text("[Request #%d] %s\nReply %saccept %d, %sreject %d [--block] [reason] or %signore %d.",
+				eventID, describeRequest(e), p, eventID, p, eventID, p, eventID)
+			for _, admin := range c.Config.Admin {
+				if _, err := c.SendFriendMessage(admin, text); err != nil {
+					c.Log().Error("Failed to forward request #%d to admin %d: %s", eventID, admin, err)
+				}
+			}
+		}
+
+		c.Next()
+	}
+}
+
+// requestCommands lets admins answer forwarded requests.
+func requestCommands() []*Command {
+	respond := func(action RequestAction) func(c *Context, args []string) {
+		return func(c *Context, args []string) {
+			if len(args) == 0 {
+				c.SendText("Missing request ID.")
+				return
+			}
+			id, err := strconv.Atoi(args[0])
+			if err != nil {
+				c.SendText("Invalid request ID: %s", args[0])
+				return
+			}
+			args = args[1:]
+			blacklist := len(args) > 0 && args[0] == "--block"
+			if blacklist {
+				args = args[1:]
+			}
+
+			e, ok := c.requests.take(id)
+			if !ok {
+				c.SendText("No pending request #%d, it may have expired.", id)
+				return
+			}
+			if err := c.RespondRequest(e, action, blacklist, strings.Join(args, " ")); err != nil {
+				c.requests.add(e)
+				c.SendText("Failed to answer request #%d: %s", id, err)
+				return
+			}
+			c.SendText("Request #%d answered.", id)
+		}
+	}
+
+	return []*Command{
+		{Name: "accept", Usage: "accept a forwarded request: accept <id> [message]", Admin: true, Handler: respond(RequestAccept)},
+		{Name: "reject", Usage: "reject a forwarded request: reject <id> [--block] [reason]", Admin: true, Handler: respond(RequestReject)},
+		{Name: "ignore", Usage: "ignore a forwarded request: ignore <id> [--block]", Admin: true, Handler: respond(RequestIgnore)},
+	}
+}
@@ -0,0 +1,249 @@
+package core
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"golang.org/x/xerrors"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// APIConfig holds the settings of the admin REST API.
+type APIConfig struct {
+	Enable bool     `yaml:"enable"` // Serve the API at /api/v1
+	Tokens []string `yaml:"tokens"` // Bearer tokens allowed to call the API
+	Rate   float64  `yaml:"rate"`   // Requests per second allowed per token
+	Burst  int      `yaml:"burst"`  // Requests allowed at once per token
+}
+
+// DefaultAPIConfig provides a basic default APIConfig.
+func DefaultAPIConfig() APIConfig {
+	return APIConfig{
+		Enable: false,
+		Tokens: []string{},
+		Rate:   1,
+		Burst:  10,
+	}
+}
+
+// rateLimiter is a token bucket per key.
+type rateLimiter struct {
+	rate  float64
+	burst float64
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter(rate float64, burst int) *rateLimiter {
+	return &rateLimiter{rate: rate, burst: float64(burst), buckets: make(map[string]*bucket)}
+}
+
+// allow takes a token from the bucket of key and reports whether there was one.
+func (l *rateLimiter) allow(key string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens += now.Sub(b.last).Seconds() * l.rate
+	if b.tokens > l.burst {
+		b.tokens = l.burst
+	}
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// apiError aborts an API request with a JSON error.
+func apiError(gc *gin.Context, status int, err error) {
+	gc.AbortWithStatusJSON(status, gin.H{"error": err.Error()})
+}
+
+// authAPI checks the bearer token of API requests and rate-limits each token.
+func (b *Bot) authAPI() gin.HandlerFunc {
+	limiter := newRateLimiter(b.Config.API.Rate, b.Config.API.Burst)
+	return func(gc *gin.Context) {
+		token, ok := strings.CutPrefix(gc.GetHeader("Authorization"), "Bearer ")
+		index := b.tokenIndex(token)
+		if !ok || index < 0 {
+			gc.Header("WWW-Authenticate", "Bearer")
+			apiError(gc, http.StatusUnauthorized, xerrors.New("invalid or missing bearer token"))
+			return
+		}
+		if !limiter.allow(token) {
+			apiError(gc, http.StatusTooManyRequests, xerrors.New("rate limit exceeded"))
+			return
+		}
+		// audit entries name the token by its position in the config, not its value
+		gc.Request = gc.Request.WithContext(withAuditActor(gc.Request.Context(), fmt.Sprintf("api:#%d", index+1)))
+		gc.Next()
+	}
+}
+
+// tokenIndex returns the position of token in the configured API tokens, or -1.
+func (b *Bot) tokenIndex(token string) int {
+	index := -1
+	for i, t := range b.Config.API.Tokens {
+		if t != "" && subtle.ConstantTimeCompare([]byte(t), []byte(token)) == 1 {
+			index = i
+		}
+	}
+	return index
+}
+
+// apiMessageRequest is the body of POST /api/v1/messages.
+type apiMessageRequest struct {
+	Kind  SubjectKind `json:"kind" binding:"required"` // Friend, Group or Temp
+	ID    int         `json:"id" binding:"required"`   // Friend, group or member ID
+	Group int         `json:"group"`                   // Group of a temp chat
+	Text  string      `json:"text" binding:"required"`
+	Quote int         `json:"quote"` // ID of a message to quote
+}
+
+// apiFeatureRequest is the body of POST /api/v1/features.
+type apiFeatureRequest struct {
+	Kind    SubjectKind `json:"kind" binding:"required"` // Friend or Group
+	ID      int         `json:"id" binding:"required"`
+	Name    string      `json:"name" binding:"required"`
+	Enabled bool        `json:"enabled"`
+}
+
+// apiLogLevelRequest is the body of PUT /api/v1/log/level.
+type apiLogLevelRequest struct {
+	Level LogLevel `json:"level" binding:"required"`
+	Sink  string   `json:"sink"` // console or file, all sinks if empty
+}
+
+// featureChatOf validates the chat of a feature switch.
+func featureChatOf(kind SubjectKind, id int) (Subject, error) {
+	if kind != GroupSubject && kind != FriendSubject {
+		return Subject{}, xerrors.Errorf("kind must be %s or %s", GroupSubject, FriendSubject)
+	}
+	return Subject{Kind: kind, ID: id}, nil
+}
+
+// setupAPI registers the admin REST API at /api/v1 when enabled.
+func (b *Bot) setupAPI() {
+	if !b.Config.API.Enable {
+		return
+	}
+	if len(b.Config.API.Tokens) == 0 {
+		Log().Warn("The admin API is enabled without tokens, every request will be rejected.")
+	}
+
+	api := b.Server.Group("/api/v1", b.authAPI())
+
+	api.GET("/status", func(gc *gin.Context) {
+		gc.JSON(http.StatusOK, b.Status())
+	})
+
+	api.GET("/groups", func(gc *gin.Context) {
+		groups, err := b.Client.WithContext(gc.Request.Context()).GroupList()
+		if err != nil {
+			apiError(gc, http.StatusBadGateway, err)
+			return
+		}
+		gc.JSON(http.StatusOK, gin.H{"groups": groups})
+	})
+
+	api.GET("/friends", func(gc *gin.Context) {
+		friends, err := b.Client.WithContext(gc.Request.Context()).FriendList()
+		if err != nil {
+			apiError(gc, http.StatusBadGateway, err)
+			return
+		}
+		gc.JSON(http.StatusOK, gin.H{"friends": friends})
+	})
+
+	api.POST("/messages", func(gc *gin.Context) {
+		var req apiMessageRequest
+		if err := gc.ShouldBindJSON(&req); err != nil {
+			apiError(gc, http.StatusBadRequest, err)
+			return
+		}
+		switch req.Kind {
+		case FriendSubject, GroupSubject, TempSubject:
+		default:
+			apiError(gc, http.StatusBadRequest, xerrors.Errorf("kind must be %s, %s or %s", FriendSubject, GroupSubject, TempSubject))
+			return
+		}
+
+		s := Subject{Kind: req.Kind, ID: req.ID, Group: req.Group}
+		id, err := b.Client.WithContext(gc.Request.Context()).SendQuote(s, req.Quote, Text("%s", req.Text))
+		if err != nil {
+			apiError(gc, http.StatusBadGateway, err)
+			return
+		}
+		gc.JSON(http.StatusOK, gin.H{"id": id})
+	})
+
+	api.GET("/plugins", func(gc *gin.Context) {
+		gc.JSON(http.StatusOK, gin.H{"plugins": b.Plugins()})
+	})
+
+	api.GET("/features", func(gc *gin.Context) {
+		id, err := strconv.Atoi(gc.Query("id"))
+		if err != nil {
+			apiError(gc, http.StatusBadRequest, xerrors.Errorf("invalid id: %w", err))
+			return
+		}
+		chat, err := featureChatOf(SubjectKind(gc.Query("kind")), id)
+		if err != nil {
+			apiError(gc, http.StatusBadRequest, err)
+			return
+		}
+		gc.JSON(http.StatusOK, gin.H{"disabled": b.Features.Disabled(chat)})
+	})
+
+	api.POST("/features", func(gc *gin.Context) {
+		var req apiFeatureRequest
+		if err := gc.ShouldBindJSON(&req); err != nil {
+			apiError(gc, http.StatusBadRequest, err)
+			return
+		}
+		chat, err := featureChatOf(req.Kind, req.ID)
+		if err != nil {
+			apiError(gc, http.StatusBadRequest, err)
+			return
+		}
+		if err := b.SwitchFeature(gc.Request.Context(), chat, req.Name, req.Enabled); err != nil {
+			status := http.StatusInternalServerError
+			if xerrors.Is(err, ErrUnknownFeature) {
+				status = http.StatusNotFound
+			}
+			apiError(gc, status, err)
+			return
+		}
+		gc.JSON(http.StatusOK, gin.H{"name": req.Name, "enabled": req.Enabled})
+	})
+
+	api.PUT("/log/level", func(gc *gin.Context) {
+		var req apiLogLevelRequest
+		if err := gc.ShouldBindJSON(&req); err != nil {
+			apiError(gc, http.StatusBadRequest, err)
+			return
+		}
+		if err := b.SetLogLevel(gc.Request.Context(), req.Sink, req.Level); err != nil {
+			apiError(gc, http.StatusBadRequest, err)
+			return
+		}
+		gc.JSON(http.StatusOK, gin.H{"levels": Log().Levels()})
+	})
+}
@@ -0,0 +1,274 @@
+package core
+
+import (
+	"context"
+	"github.com/robfig/cron/v3"
+	"golang.org/x/xerrors"
+	"sync"
+	"time"
+)
+
+// MisfirePolicy decides what a durable job does about runs missed while the bot was down.
+type MisfirePolicy int
+
+const (
+	MisfireSkip    MisfirePolicy = iota // Wait for the next scheduled time
+	MisfireRunOnce                      // Run once right away, then follow the schedule
+)
+
+// JobContext is passed to running jobs. It is cancelled when the scheduler stops.
+// The embedded Client sends its requests with it, and Namespace binds storage to it.
+type JobContext struct {
+	context.Context
+	*Bot
+	*Client
+	Name      string    // Job name
+	Scheduled time.Time // Time the run was scheduled for
+}
+
+// Namespace returns the storage namespace called name, bound to the JobContext.
+func (jc *JobContext) Namespace(name string) *Namespace {
+	return jc.Storage.Namespace(name).WithContext(jc)
+}
+
+// JobFunc is the function run by a job.
+type JobFunc func(jc *JobContext) error
+
+// JobOption configures a job.
+type JobOption func(j *job)
+
+// Durable persists the last run of the job, so that runs missed while the bot was down
+// are handled by its misfire policy and one-shot jobs don't run twice.
+func Durable() JobOption {
+	return func(j *job) {
+		j.durable = true
+	}
+}
+
+// Misfire sets the misfire policy of a durable job. The default is MisfireSkip.
+func Misfire(p MisfirePolicy) JobOption {
+	return func(j *job) {
+		j.misfire = p
+	}
+}
+
+// InLocation evaluates the schedule in loc instead of the local time zone.
+// Cron specs may also start with CRON_TZ=<zone>.
+func InLocation(loc *time.Location) JobOption {
+	return func(j *job) {
+		j.loc = loc
+	}
+}
+
+// everySchedule runs at a fixed interval.
+type everySchedule time.Duration
+
+func (e everySchedule) Next(t time.Time) time.Time { return t.Add(time.Duration(e)) }
+
+// onceSchedule runs a single time.
+type onceSchedule time.Time
+
+func (o onceSchedule) Next(t time.Time) time.Time {
+	if t.Before(time.Time(o)) {
+		return time.Time(o)
+	}
+	return time.Time{}
+}
+
+type job struct {
+	name    string
+	sched   cron.Schedule
+	fn      JobFunc
+	durable bool
+	misfire MisfirePolicy
+	loc     *time.Location
+	stop    chan struct{}
+}
+
+// cronParser accepts 5 or 6 field specs (with optional seconds) and descriptors such as @daily.
+var cronParser = cron.NewParser(cron.SecondOptional | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+
+// Scheduler runs cron, interval and one-shot jobs.
+type Scheduler struct {
+	bot *Bot
+	ns  *Namespace
+
+	mu      sync.Mutex
+	jobs    map[string]*job
+	ctx     context.Context
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+	started bool
+}
+
+// NewScheduler creates a Scheduler whose jobs run with b, persisting durable jobs in b.Storage.
+// Jobs are cancelled when the scheduler stops or the bot shuts down.
+func NewScheduler(b *Bot) *Scheduler {
+	ctx, cancel := context.WithCancel(b.ctx)
+	return &Scheduler{
+		bot:    b,
+		ns:     b.Storage.Namespace("koharu.scheduler"),
+		jobs:   make(map[string]*job),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+}
+
+// Cron schedules fn with a cron spec, e.g. "0 30 8 * * *" for 08:30:00 every day.
+func (s *Scheduler) Cron(name, spec string, fn JobFunc, opts ...JobOption) error {
+	sched, err := cronParser.Parse(spec)
+	if err != nil {
+		return xerrors.Errorf("parse cron spec of %s: %w", name, err)
+	}
+	return s.add(name, sched, fn, opts)
+}
+
+// Every schedules fn every d.
+func (s *Scheduler) Every(name string, d time.Duration, fn JobFunc, opts ...JobOption) error {
+	if d <= 0 {
+		return xerrors.Errorf("interval of %s must be positive, got %s", name, d)
+	}
+	return s.add(name, everySchedule(d), fn, opts)
+}
+
+// Once schedules fn to run once at the given time.
+// A time already passed is only honored by durable jobs with MisfireRunOnce.
+func (s *Scheduler) Once(name string, at time.Time, fn JobFunc, opts ...JobOption) error {
+	return s.add(name, onceSchedule(at), fn, opts)
+}
+
+// add registers a job, replacing any job with the same name.
+func (s *Scheduler) add(name string, sched cron.Schedule, fn JobFunc, opts []JobOption) error {
+	j := &job{name: name, sched: sched, fn: fn, loc: time.Local, stop: make(chan struct{})}
+	for _, opt := range opts {
+		opt(j)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ctx.Err() != nil {
+		return xerrors.Errorf("schedule %s: %w", name, ErrBotStopped)
+	}
+	if old, ok := s.jobs[name]; ok {
+		close(old.stop)
+	}
+	s.jobs[name] = j
+	if s.started {
+		s.spawn(j)
+	}
+	return nil
+}
+
+// Remove cancels a job.
+func (s *Scheduler) Remove(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if j, ok := s.jobs[name]; ok {
+		close(j.stop)
+		delete(s.jobs, name)
+	}
+}
+
+// Start runs the registered jobs.
+func (s *Scheduler) Start() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.started {
+		return
+	}
+	s.started = true
+	for _, j := range s.jobs {
+		s.spawn(j)
+	}
+}
+
+// Stop cancels all jobs and waits for the running ones to return until ctx is done.
+func (s *Scheduler) Stop(ctx context.Context) error {
+	s.mu.Lock()
+	s.cancel()
+	s.mu.Unlock()
+	return waitGroup(ctx, &s.wg)
+}
+
+// spawn starts the goroutine of a job. The caller must hold s.mu.
+func (s *Scheduler) spawn(j *job) {
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.loop(j)
+	}()
+}
+
+// loop waits for each scheduled time of j and runs it.
+func (s *Scheduler) loop(j *job) {
+	next := s.first(j)
+	for !next.IsZero() {
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-s.ctx.Done():
+			timer.Stop()
+			return
+		case <-j.stop:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		s.exec(j, next)
+		next = j.sched.Next(time.Now().In(j.loc))
+	}
+}
+
+// first returns the first time j should run, applying the misfire policy of durable jobs.
+func (s *Scheduler) first(j *job) time.Time {
+	now := time.Now().In(j.loc)
+	if !j.durable {
+		return j.sched.Next(now)
+	}
+
+	var last int64
+	err := s.ns.View(func(tx *Tx) error {
+		return tx.Get(j.name, &last)
+	})
+	switch {
+	case xerrors.Is(err, ErrNotFound):
+		if _, once := j.sched.(onceSchedule); once {
+			// a one-shot job never run: its time may already have passed
+			return s.misfired(j, j.sched.Next(time.Time{}), now)
+		}
+		return j.sched.Next(now)
+	case err != nil:
+		Log().Error("Failed to read last run of job %s: %s", j.name, err)
+		return j.sched.Next(now)
+	}
+
+	return s.misfired(j, j.sched.Next(time.Unix(0, last).In(j.loc)), now)
+}
+
+// misfired returns when j should run given it was due at due.
+func (s *Scheduler) misfired(j *job, due, now time.Time) time.Time {
+	if due.IsZero() || !due.Before(now) {
+		return due
+	}
+	if j.misfire == MisfireRunOnce {
+		Log().Info("Job %s missed its run at %s, running it now.", j.name, due.Format(time.RFC3339))
+		return now
+	}
+	Log().Info("Job %s missed its run at %s, skipping it.", j.name, due.Format(time.RFC3339))
+	return j.sched.Next(now)
+}
+
+// exec runs j once, recovering from panics and recording the run of durable jobs.
+func (s *Scheduler) exec(j *job, scheduled time.Time) {
+	jc := &JobContext{Context: s.ctx, Bot: s.bot, Name: j.name, Scheduled: scheduled}
+	jc.Client = s.bot.Client.WithContext(jc)
+	if err := safeCall(func() error { return j.fn(jc) }); err != nil {
+		Log().Error("Job %s failed: %s", j.name, err)
+	}
+
+	if j.durable {
+		if err := Put(s.ns, j.name, time.Now().UnixNano(), 0); err != nil {
+			Log().Error("Failed to record run of job %s: %s", j.name, err)
+		}
+	}
+}
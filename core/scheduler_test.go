@@ -0,0 +1,96 @@
+package core
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newTestBot creates a Bot keeping its storage in a temporary directory, without starting it.
+func newTestBot(t *testing.T) *Bot {
+	t.Helper()
+	cfg := DefaultConfig()
+	cfg.Storage.Dir = t.TempDir()
+	b := New(WithConfig(cfg))
+	t.Cleanup(func() {
+		_ = b.Storage.Close()
+	})
+	return b
+}
+
+func nop(*JobContext) error { return nil }
+
+func TestDurableOnceRunsOnce(t *testing.T) {
+	b := newTestBot(t)
+	at := time.Now().Add(20 * time.Millisecond)
+	var runs atomic.Int32
+	run := func(*JobContext) error {
+		runs.Add(1)
+		return nil
+	}
+
+	// the second scheduler stands for the bot restarting after the run
+	for i := 0; i < 2; i++ {
+		s := NewScheduler(b)
+		if err := s.Once("once", at, run, Durable(), Misfire(MisfireRunOnce)); err != nil {
+			t.Fatal(err)
+		}
+		s.Start()
+		time.Sleep(100 * time.Millisecond)
+		if err := s.Stop(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := runs.Load(); n != 1 {
+		t.Errorf("durable one-shot job ran %d times, want 1", n)
+	}
+}
+
+func TestMisfirePolicy(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		policy MisfirePolicy
+		runNow bool
+	}{
+		{"skip", MisfireSkip, false},
+		{"run once", MisfireRunOnce, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s := NewScheduler(newTestBot(t))
+			if err := Put(s.ns, "hourly", time.Now().Add(-2*time.Hour).UnixNano(), 0); err != nil {
+				t.Fatal(err)
+			}
+			if err := s.Every("hourly", time.Hour, nop, Durable(), Misfire(tc.policy)); err != nil {
+				t.Fatal(err)
+			}
+
+			now := time.Now()
+			next := s.first(s.jobs["hourly"])
+			if runNow := next.Sub(now) < time.Minute; runNow != tc.runNow {
+				t.Errorf("missed job scheduled at %s, %s from now, want run now %t", next, next.Sub(now), tc.runNow)
+			}
+		})
+	}
+}
+
+func TestScheduleLocation(t *testing.T) {
+	tokyo, err := time.LoadLocation("Asia/Tokyo")
+	if err != nil {
+		t.Skipf("no time zone database: %s", err)
+	}
+	s := NewScheduler(newTestBot(t))
+	if err := s.Cron("option", "0 0 9 * * *", nop, InLocation(tokyo)); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Cron("spec", "CRON_TZ=Asia/Tokyo 0 9 * * *", nop); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, j := range s.jobs {
+		next := s.first(j).In(tokyo)
+		if next.Hour() != 9 || next.Minute() != 0 {
+			t.Errorf("job %s scheduled at %s, want 09:00 in Tokyo", name, next)
+		}
+	}
+}
@@ -6,83 +6,85 @@ import (
 	"github.com/gin-gonic/gin"
 	"golang.org/x/xerrors"
 	"net/http"
-	"os"
-	"os/signal"
-	"syscall"
 	"time"
 )
 
 type Server struct {
 	*gin.Engine
 	httpServer *http.Server
+	shutdown   time.Duration // Graceful shutdown timeout of Run
+	bot        *Bot          // Bot serving through this Server, see POST and Use
 }
 
 func NewServer(cfg ServerConfig) *Server {
 	gin.SetMode(gin.ReleaseMode)
 	r := gin.New()
-	r.Use(gin.Recovery())
-	// r.Use(Recovery())
-	// TODO: replace with impl core.Recovery
+	r.Use(recoverHTTP())
 
 	s := &http.Server{
 		Addr:    cfg.Address,
 		Handler: r,
 	}
 
-	return &Server{r, s}
+	return &Server{Engine: r, httpServer: s, shutdown: time.Duration(cfg.Shutdown) * time.Second}
 }
 
 func DefaultServer() *Server {
 	return NewServer(DefaultServerConfig())
 }
 
-func (s *Server) Run() error {
-	srv := s.httpServer
+// POST runs middlewares as the chain of the events posted to relativePath.
+//
+// Deprecated: events are dispatched by the Bot, register plain gin handlers with Engine.POST.
+func (s *Server) POST(relativePath string, middlewares ...Middleware) {
+	s.Engine.POST(relativePath, func(gc *gin.Context) {
+		raw, err := gc.GetRawData()
+		if err != nil {
+			gc.Status(http.StatusBadRequest)
+			return
+		}
+		s.bot.dispatch(s.bot.NewContext(nil, raw), middlewares)
+		gc.Status(http.StatusOK)
+	})
+}
+
+// Use adds middlewares to the chain of the Bot.
+//
+// Deprecated: use Bot.Use.
+func (s *Server) Use(middlewares ...Middleware) {
+	for _, m := range middlewares {
+		s.bot.Use(m)
+	}
+}
+
+// Run serves HTTP until ctx is done, then shuts the server down within ServerConfig.Shutdown.
+//
+// Deprecated: use Start and Shutdown, or let Bot.Run manage the server.
+func (s *Server) Run(ctx context.Context) error {
+	s.Start()
+	<-ctx.Done()
 
+	shutdown, cancel := context.WithTimeout(context.Background(), s.shutdown)
+	defer cancel()
+	return s.Shutdown(shutdown)
+}
+
+// Start serves HTTP in the background.
+func (s *Server) Start() {
 	go func() {
-		err := srv.ListenAndServe()
+		err := s.httpServer.ListenAndServe()
 		if err != nil && !errors.Is(err, http.ErrServerClosed) {
 			Log().Fatal("listen: %s", err)
 		}
 	}()
+}
 
-	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
-	<-quit
+// Shutdown stops accepting requests and waits for the active ones until ctx is done.
+func (s *Server) Shutdown(ctx context.Context) error {
 	Log().Info("Shutting down server...")
-
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-	if err := srv.Shutdown(ctx); err != nil {
+	if err := s.httpServer.Shutdown(ctx); err != nil {
 		return xerrors.Errorf("server shutdown failed: %w", err)
 	}
-
 	Log().Info("Server gracefully stopped")
 	return nil
 }
-
-type Middleware func(*Context)
-
-func handlerFunc(handler Middleware) func(ctx *gin.Context) {
-	return func(c *gin.Context) {
-		handler(&Context{gContext: c})
-	}
-}
-
-func (s *Server) POST(relativePath string, middlewares ...Middleware) {
-	gHandles := make([]gin.HandlerFunc, 0)
-	for _, middleware := range middlewares {
-		gHandles = append(gHandles, handlerFunc(middleware))
-	}
-
-	s.Engine.POST(relativePath, gHandles...)
-}
-
-func (s *Server) Use(middlewares ...Middleware) {
-	gMiddlewares := make([]gin.HandlerFunc, 0)
-	for _, middleware := range middlewares {
-		gMiddlewares = append(gMiddlewares, handlerFunc(middleware))
-	}
-
-	s.RouterGroup.Use(gMiddlewares...)
-}
@@ -0,0 +1,91 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"golang.org/x/xerrors"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Stop starts the graceful shutdown of the bot, making Run return once done.
+func (b *Bot) Stop() {
+	b.stopOnce.Do(func() {
+		close(b.stopped)
+	})
+}
+
+// handleSignals stops the bot on SIGINT or SIGTERM. A second signal forces an immediate exit.
+func (b *Bot) handleSignals() {
+	quit := make(chan os.Signal, 2)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(quit)
+
+	select {
+	case sig := <-quit:
+		Log().Info("Received %s, shutting down gracefully, signal again to force...", sig)
+		b.Stop()
+	case <-b.stopped:
+	}
+
+	select {
+	case sig := <-quit:
+		Log().Warn("Received %s again, exiting now.", sig)
+		b.cancel()
+		_ = Log().Sync()
+		os.Exit(1)
+	case <-b.ctx.Done():
+	}
+}
+
+// shutdown stops the bot within ServerConfig.Shutdown: it stops accepting events, drains the
+// dispatch queue, waits for the goroutines started with Go and the requests in flight,
+// stops plugins in reverse order, then closes storage and syncs logs.
+// The root context is cancelled once done or when the timeout expires, whichever comes first.
+func (b *Bot) shutdown() error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(b.Config.Server.Shutdown)*time.Second)
+	defer cancel()
+	go func() {
+		<-ctx.Done()
+		b.cancel()
+	}()
+
+	var errs []error
+	step := func(name string, err error) {
+		if err != nil {
+			Log().Error("Shutdown: %s: %s", name, err)
+			errs = append(errs, xerrors.Errorf("%s: %w", name, err))
+		}
+	}
+
+	step("stop server", b.Server.Shutdown(ctx))
+	step("stop jobs", b.Scheduler.Stop(ctx))
+	step("drain events", b.Dispatcher.Stop(ctx))
+	step("wait for goroutines", waitGroup(ctx, &b.routines))
+	step("flush requests", b.Client.Flush(ctx))
+	step("stop plugins", b.stopPlugins(ctx))
+	b.cancel()
+	step("close storage", b.Storage.Close())
+	step("close audit log", b.Audit.Close())
+	_ = Log().Sync() // fails on consoles, nothing to do about it
+
+	return errors.Join(errs...)
+}
+
+// waitGroup waits for wg until ctx is done.
+func waitGroup(ctx context.Context, wg *sync.WaitGroup) error {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,286 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	bolt "go.etcd.io/bbolt"
+	"golang.org/x/xerrors"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+var ErrNotFound = errors.New("key not found")
+
+// StorageConfig holds the settings of the embedded storage.
+type StorageConfig struct {
+	Dir   string `yaml:"dir"`   // Data directory
+	Sweep int    `yaml:"sweep"` // Minutes between two sweeps of expired keys, 0 to only sweep when opening
+}
+
+// DefaultStorageConfig provides a basic default StorageConfig.
+func DefaultStorageConfig() StorageConfig {
+	return StorageConfig{
+		Dir:   "data",
+		Sweep: 60,
+	}
+}
+
+// Storage is a persistent key-value store, opened on first use.
+// Keys live in namespaces, usually one per plugin. It is safe for concurrent use.
+type Storage struct {
+	path string
+
+	once sync.Once
+	db   *bolt.DB
+	err  error
+}
+
+// NewStorage creates a Storage in cfg.Dir.
+func NewStorage(cfg StorageConfig) *Storage {
+	return &Storage{path: filepath.Join(cfg.Dir, "koharu.db")}
+}
+
+// open opens the database on first call, sweeping expired keys.
+func (s *Storage) open() (*bolt.DB, error) {
+	s.once.Do(func() {
+		if err := os.MkdirAll(filepath.Dir(s.path), 0o755); err != nil {
+			s.err = xerrors.Errorf("create data dir: %w", err)
+			return
+		}
+		s.db, s.err = bolt.Open(s.path, 0o600, &bolt.Options{Timeout: time.Second})
+		if s.err != nil {
+			s.err = xerrors.Errorf("open storage %s: %w", s.path, s.err)
+			return
+		}
+		if err := sweep(s.db); err != nil {
+			Log().Warn("Failed to sweep expired keys: %s", err)
+		}
+	})
+	return s.db, s.err
+}
+
+// Close closes the database if it was opened.
+func (s *Storage) Close() error {
+	if s.db == nil {
+		return nil
+	}
+	return s.db.Close()
+}
+
+// Sweep deletes expired keys of all namespaces.
+func (s *Storage) Sweep() error {
+	db, err := s.open()
+	if err != nil {
+		return err
+	}
+	return sweep(db)
+}
+
+// setupSweep schedules the periodic sweep of expired keys.
+func (b *Bot) setupSweep() {
+	if b.Config.Storage.Sweep <= 0 {
+		return
+	}
+	err := b.Scheduler.Every("koharu.storage.sweep", time.Duration(b.Config.Storage.Sweep)*time.Minute, func(jc *JobContext) error {
+		return jc.Storage.Sweep()
+	})
+	if err != nil {
+		Log().Error("Failed to schedule storage sweep: %s", err)
+	}
+}
+
+// sweep deletes expired keys of all buckets of db.
+func sweep(db *bolt.DB) error {
+	now := time.Now()
+	return db.Update(func(btx *bolt.Tx) error {
+		return btx.ForEach(func(_ []byte, b *bolt.Bucket) error {
+			var expired [][]byte
+			err := b.ForEach(func(k, v []byte) error {
+				if isExpired(v, now) {
+					expired = append(expired, k)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			for _, k := range expired {
+				if err := b.Delete(k); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	})
+}
+
+// Namespace returns the namespace called name.
+func (s *Storage) Namespace(name string) *Namespace {
+	return &Namespace{s: s, name: []byte(name), ctx: context.Background()}
+}
+
+// Namespace is an isolated set of keys within a Storage.
+type Namespace struct {
+	s    *Storage
+	name []byte
+	ctx  context.Context
+}
+
+// WithContext returns a copy of the namespace whose transactions don't start once ctx is done.
+func (ns *Namespace) WithContext(ctx context.Context) *Namespace {
+	cp := *ns
+	cp.ctx = ctx
+	return &cp
+}
+
+// begin opens the database unless the context of the namespace is done.
+func (ns *Namespace) begin() (*bolt.DB, error) {
+	if err := ns.ctx.Err(); err != nil {
+		return nil, err
+	}
+	return ns.s.open()
+}
+
+// View runs fn in a read-only transaction.
+func (ns *Namespace) View(fn func(tx *Tx) error) error {
+	db, err := ns.begin()
+	if err != nil {
+		return err
+	}
+	return db.View(func(btx *bolt.Tx) error {
+		return fn(&Tx{b: btx.Bucket(ns.name), now: time.Now()})
+	})
+}
+
+// Update runs fn in a read-write transaction, which is rolled back if fn returns an error.
+func (ns *Namespace) Update(fn func(tx *Tx) error) error {
+	db, err := ns.begin()
+	if err != nil {
+		return err
+	}
+	return db.Update(func(btx *bolt.Tx) error {
+		b, err := btx.CreateBucketIfNotExists(ns.name)
+		if err != nil {
+			return err
+		}
+		return fn(&Tx{b: b, now: time.Now()})
+	})
+}
+
+// Delete removes a key.
+func (ns *Namespace) Delete(key string) error {
+	return ns.Update(func(tx *Tx) error {
+		return tx.Delete(key)
+	})
+}
+
+// Tx is a transaction within a namespace. Values are stored as JSON.
+type Tx struct {
+	b   *bolt.Bucket // nil in a read-only transaction on a namespace never written to
+	now time.Time
+}
+
+// Get decodes the value of key into v, or returns ErrNotFound.
+func (tx *Tx) Get(key string, v interface{}) error {
+	if tx.b == nil {
+		return ErrNotFound
+	}
+	raw := tx.b.Get([]byte(key))
+	if raw == nil || isExpired(raw, tx.now) {
+		return ErrNotFound
+	}
+	if err := json.Unmarshal(raw[8:], v); err != nil {
+		return xerrors.Errorf("decode %s: %w", key, err)
+	}
+	return nil
+}
+
+// Put stores v under key. A positive ttl makes the key expire after that duration.
+func (tx *Tx) Put(key string, v interface{}, ttl time.Duration) error {
+	if tx.b == nil || !tx.b.Writable() {
+		return bolt.ErrTxNotWritable
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return xerrors.Errorf("encode %s: %w", key, err)
+	}
+
+	var expires int64
+	if ttl > 0 {
+		expires = tx.now.Add(ttl).UnixNano()
+	}
+	raw := make([]byte, 8+len(data))
+	binary.BigEndian.PutUint64(raw, uint64(expires))
+	copy(raw[8:], data)
+	return tx.b.Put([]byte(key), raw)
+}
+
+// Delete removes key.
+func (tx *Tx) Delete(key string) error {
+	if tx.b == nil || !tx.b.Writable() {
+		return bolt.ErrTxNotWritable
+	}
+	return tx.b.Delete([]byte(key))
+}
+
+// Scan calls fn in key order for each live key starting with prefix, with its raw JSON value.
+// Returning an error from fn stops the scan.
+func (tx *Tx) Scan(prefix string, fn func(key string, value json.RawMessage) error) error {
+	if tx.b == nil {
+		return nil
+	}
+	p := []byte(prefix)
+	c := tx.b.Cursor()
+	for k, v := c.Seek(p); k != nil && bytes.HasPrefix(k, p); k, v = c.Next() {
+		if isExpired(v, tx.now) {
+			continue
+		}
+		if err := fn(string(k), v[8:]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isExpired reports whether a stored value has expired at now.
+func isExpired(raw []byte, now time.Time) bool {
+	if len(raw) < 8 {
+		return true
+	}
+	expires := int64(binary.BigEndian.Uint64(raw))
+	return expires != 0 && now.UnixNano() >= expires
+}
+
+// Get returns the value of key in ns, or ErrNotFound.
+func Get[T any](ns *Namespace, key string) (T, error) {
+	var v T
+	err := ns.View(func(tx *Tx) error {
+		return tx.Get(key, &v)
+	})
+	return v, err
+}
+
+// Put stores v under key in ns. A positive ttl makes the key expire after that duration.
+func Put[T any](ns *Namespace, key string, v T, ttl time.Duration) error {
+	return ns.Update(func(tx *Tx) error {
+		return tx.Put(key, v, ttl)
+	})
+}
+
+// Scan calls fn in key order for each live key of ns starting with prefix.
+func Scan[T any](ns *Namespace, prefix string, fn func(key string, v T) error) error {
+	return ns.View(func(tx *Tx) error {
+		return tx.Scan(prefix, func(key string, value json.RawMessage) error {
+			var v T
+			if err := json.Unmarshal(value, &v); err != nil {
+				return xerrors.Errorf("decode %s: %w", key, err)
+			}
+			return fn(key, v)
+		})
+	})
+}
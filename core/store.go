@@ -0,0 +1,206 @@
+package core
+
+import (
+	"encoding/json"
+	"golang.org/x/xerrors"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// MessageStoreConfig holds the settings of the message store.
+type MessageStoreConfig struct {
+	Enable     bool `yaml:"enable"`      // Record incoming messages
+	Size       int  `yaml:"size"`        // Max messages kept
+	TTL        int  `yaml:"ttl"`         // Seconds a message is kept
+	AntiRecall bool `yaml:"anti_recall"` // Repost recalled messages, requires Enable
+	RecallTo   int  `yaml:"recall_to"`   // Group to repost to, bot admins if 0
+}
+
+// DefaultMessageStoreConfig provides a basic default MessageStoreConfig.
+func DefaultMessageStoreConfig() MessageStoreConfig {
+	return MessageStoreConfig{
+		Enable:     false,
+		Size:       10000,
+		TTL:        3600,
+		AntiRecall: false,
+		RecallTo:   0,
+	}
+}
+
+// StoredMessage is a message recorded by the MessageStore.
+type StoredMessage struct {
+	ID       int
+	Time     int
+	Subject  Subject
+	SenderID int
+	Chain    MessageChain
+}
+
+// messageKey identifies a message; mirai message IDs are only unique within a chat.
+type messageKey struct {
+	Subject Subject
+	ID      int
+}
+
+// MessageStore keeps recent incoming messages so that they can be looked up by ID.
+type MessageStore struct {
+	cache *lruCache[messageKey, *StoredMessage]
+}
+
+// NewMessageStore creates a MessageStore from cfg.
+func NewMessageStore(cfg MessageStoreConfig) *MessageStore {
+	return &MessageStore{
+		cache: newLRUCache[messageKey, *StoredMessage](cfg.Size, time.Duration(cfg.TTL)*time.Second),
+	}
+}
+
+// Add records a message event. Events without a Source are ignored.
+func (s *MessageStore) Add(e MessageEvent) {
+	src := e.Chain().Source()
+	if src == nil {
+		return
+	}
+	subject := e.Subject()
+	s.cache.Add(messageKey{subject, src.ID}, &StoredMessage{
+		ID:       src.ID,
+		Time:     src.Time,
+		Subject:  subject,
+		SenderID: e.SenderID(),
+		Chain:    e.Chain(),
+	})
+}
+
+// Get returns a recorded message of a chat.
+func (s *MessageStore) Get(subject Subject, id int) (*StoredMessage, bool) {
+	return s.cache.Get(messageKey{subject, id})
+}
+
+// Source returns the Source component of the chain, if any.
+func (chain MessageChain) Source() *Source {
+	for _, comp := range chain {
+		if s, ok := comp.(*Source); ok {
+			return s
+		}
+	}
+	return nil
+}
+
+// MessageFromID fetches a message from mirai's cache. target is the friend or group the message was sent in.
+func (c *Client) MessageFromID(target, id int) (MessageEvent, error) {
+	var resp struct {
+		Data json.RawMessage `json:"data"`
+	}
+	q := url.Values{"target": {strconv.Itoa(target)}, "messageId": {strconv.Itoa(id)}}
+	if err := c.Get("/messageFromId", q, &resp); err != nil {
+		return nil, err
+	}
+
+	e, err := ParseEvent(resp.Data)
+	if err != nil {
+		return nil, xerrors.Errorf("parse message %d: %w", id, err)
+	}
+	msg, ok := e.(MessageEvent)
+	if !ok {
+		return nil, xerrors.Errorf("message %d is a %s", id, e.EventType())
+	}
+	return msg, nil
+}
+
+// LookupMessage returns a message of the current chat by ID,
+// from the message store if enabled, otherwise from mirai.
+func (c *Context) LookupMessage(id int) (*StoredMessage, error) {
+	subject, ok := SubjectOf(c.Event)
+	if !ok {
+		return nil, xerrors.Errorf("%s has no chat to look up messages in", c.Event.EventType())
+	}
+	return c.lookupMessage(subject, id)
+}
+
+func (c *Context) lookupMessage(subject Subject, id int) (*StoredMessage, error) {
+	if c.Messages != nil {
+		if m, ok := c.Messages.Get(subject, id); ok {
+			return m, nil
+		}
+	}
+
+	target := subject.ID
+	if subject.Kind == TempSubject {
+		target = subject.Group
+	}
+	e, err := c.MessageFromID(target, id)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &StoredMessage{ID: id, Subject: subject, SenderID: e.SenderID(), Chain: e.Chain()}
+	if src := e.Chain().Source(); src != nil {
+		m.Time = src.Time
+	}
+	return m, nil
+}
+
+// Remember records incoming messages into Bot.Messages when the store is enabled.
+func Remember() Middleware {
+	return func(c *Context) {
+		if e, ok := c.Event.(MessageEvent); ok && c.Messages != nil {
+			c.Messages.Add(e)
+		}
+		c.Next()
+	}
+}
+
+// AntiRecall reposts recalled messages to MessageStoreConfig.RecallTo or to the bot admins.
+func AntiRecall() Middleware {
+	return func(c *Context) {
+		if !c.Config.MessageStore.AntiRecall || c.Messages == nil {
+			c.Next()
+			return
+		}
+
+		var header MessageChain
+		var subject Subject
+		var id int
+		switch e := c.Event.(type) {
+		case *GroupRecallEvent:
+			subject, id = Subject{Kind: GroupSubject, ID: e.Group.ID}, e.MessageID
+			header = Text("[Recall] %d recalled a message in %s(%d):\n", e.AuthorID, e.Group.Name, e.Group.ID)
+		case *FriendRecallEvent:
+			subject, id = Subject{Kind: FriendSubject, ID: e.AuthorID}, e.MessageID
+			header = Text("[Recall] friend %d recalled a message:\n", e.AuthorID)
+		default:
+			c.Next()
+			return
+		}
+
+		m, ok := c.Messages.Get(subject, id)
+		if !ok {
+			c.Log().Debug("Recalled message %d of %s %d is not in the store", id, subject.Kind, subject.ID)
+			c.Next()
+			return
+		}
+
+		chain := header
+		for _, comp := range m.Chain {
+			switch comp.(type) {
+			case *Source, *Quote:
+				continue
+			}
+			chain = append(chain, comp)
+		}
+
+		if to := c.Config.MessageStore.RecallTo; to != 0 {
+			if _, err := c.SendGroupMessage(to, chain); err != nil {
+				c.Log().Error("Failed to repost recalled message %d: %s", id, err)
+			}
+		} else {
+			for _, admin := range c.Config.Admin {
+				if _, err := c.SendFriendMessage(admin, chain); err != nil {
+					c.Log().Error("Failed to repost recalled message %d to admin %d: %s", id, admin, err)
+				}
+			}
+		}
+
+		c.Next()
+	}
+}
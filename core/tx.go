@@ -1 +1,361 @@
 package core
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"golang.org/x/xerrors"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Status codes returned by mirai-api-http.
+// See https://docs.mirai.mamoe.net/mirai-api-http/api/API.html#状态码
+const (
+	CodeSuccess         = 0
+	CodeWrongVerifyKey  = 1
+	CodeBotNotFound     = 2
+	CodeSessionInvalid  = 3
+	CodeSessionUnbound  = 4
+	CodeTargetNotFound  = 5
+	CodeFileNotFound    = 6
+	CodeNoPermission    = 10
+	CodeBotMuted        = 20
+	CodeMessageTooLarge = 30
+	CodeBadRequest      = 400
+)
+
+// APIError is returned when mirai-api-http answers with a non-zero status code.
+type APIError struct {
+	Endpoint string
+	Code     int
+	Msg      string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("mirai %s: code %d: %s", e.Endpoint, e.Code, e.Msg)
+}
+
+// apiResponse is the common envelope of mirai-api-http responses.
+type apiResponse struct {
+	Code int    `json:"code"`
+	Msg  string `json:"msg"`
+}
+
+// Client sends requests to mirai-api-http through its HTTP adapter.
+type Client struct {
+	cfg      ServerConfig
+	http     *http.Client
+	contacts *Contacts
+	metrics  *Metrics
+	audit    *AuditLog
+	session  *session
+	pending  *pending
+	ctx      context.Context
+}
+
+// session is the mirai session shared by a Client and its copies.
+type session struct {
+	mu  sync.Mutex
+	key string
+}
+
+// pending counts the requests in flight of a Client and its copies.
+type pending struct {
+	mu   sync.Mutex
+	n    int
+	idle chan struct{}
+}
+
+func (p *pending) add() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.n++
+}
+
+func (p *pending) done() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.n--
+	if p.n == 0 && p.idle != nil {
+		close(p.idle)
+		p.idle = nil
+	}
+}
+
+// wait waits until no request is in flight or ctx is done.
+func (p *pending) wait(ctx context.Context) error {
+	p.mu.Lock()
+	if p.n == 0 {
+		p.mu.Unlock()
+		return nil
+	}
+	if p.idle == nil {
+		p.idle = make(chan struct{})
+	}
+	idle := p.idle
+	p.mu.Unlock()
+
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// NewClient creates a Client reporting to cfg.Post.
+func NewClient(cfg ServerConfig) *Client {
+	return &Client{
+		cfg:     cfg,
+		http:    &http.Client{Timeout: time.Duration(cfg.Timeout) * time.Second},
+		session: &session{},
+		pending: &pending{},
+		ctx:     context.Background(),
+	}
+}
+
+// WithContext returns a copy of the Client whose requests are cancelled with ctx.
+// The copy shares the session of c.
+func (c *Client) WithContext(ctx context.Context) *Client {
+	cp := *c
+	cp.ctx = ctx
+	return &cp
+}
+
+// DefaultClient creates a Client with DefaultServerConfig.
+func DefaultClient() *Client {
+	return NewClient(DefaultServerConfig())
+}
+
+// Flush waits for the requests in flight of the Client and its copies to complete, until ctx is done.
+func (c *Client) Flush(ctx context.Context) error {
+	return c.pending.wait(ctx)
+}
+
+// sessionKey returns the current session, verifying and binding a new one if needed.
+// An empty key is returned when no verify key is configured (mirai singleMode).
+func (c *Client) sessionKey() (string, error) {
+	if c.cfg.Secret == "" {
+		return "", nil
+	}
+
+	c.session.mu.Lock()
+	defer c.session.mu.Unlock()
+	if c.session.key != "" {
+		return c.session.key, nil
+	}
+
+	var verified struct {
+		apiResponse
+		Session string `json:"session"`
+	}
+	if err := c.send(http.MethodPost, "/verify", nil, map[string]interface{}{"verifyKey": c.cfg.Secret}, &verified); err != nil {
+		return "", xerrors.Errorf("verify session: %w", err)
+	}
+	bind := map[string]interface{}{"sessionKey": verified.Session, "qq": c.cfg.QQ}
+	if err := c.send(http.MethodPost, "/bind", nil, bind, nil); err != nil {
+		return "", xerrors.Errorf("bind session: %w", err)
+	}
+
+	c.session.key = verified.Session
+	return c.session.key, nil
+}
+
+// resetSession drops the cached session so that the next call verifies again.
+func (c *Client) resetSession(stale string) {
+	c.session.mu.Lock()
+	defer c.session.mu.Unlock()
+	if c.session.key == stale {
+		c.session.key = ""
+	}
+}
+
+// Get calls a GET endpoint with the given query parameters and decodes the response into resp.
+func (c *Client) Get(endpoint string, query url.Values, resp interface{}) error {
+	return c.call(func(session string) error {
+		q := url.Values{}
+		for k, v := range query {
+			q[k] = v
+		}
+		if session != "" {
+			q.Set("sessionKey", session)
+		}
+		return c.send(http.MethodGet, endpoint, q, nil, resp)
+	})
+}
+
+// Post calls a POST endpoint with a JSON body and decodes the response into resp.
+// Calls with side effects are recorded in the audit log.
+func (c *Client) Post(endpoint string, req map[string]interface{}, resp interface{}) error {
+	err := c.post(endpoint, req, resp)
+	if audited[endpoint] {
+		c.audit.Record(c.ctx, endpoint, req, err)
+	}
+	return err
+}
+
+func (c *Client) post(endpoint string, req map[string]interface{}, resp interface{}) error {
+	return c.call(func(session string) error {
+		body := map[string]interface{}{}
+		for k, v := range req {
+			body[k] = v
+		}
+		if session != "" {
+			body["sessionKey"] = session
+		}
+		return c.send(http.MethodPost, endpoint, nil, body, resp)
+	})
+}
+
+// call runs fn with a session key, retrying once with a fresh session if mirai rejected it.
+func (c *Client) call(fn func(session string) error) error {
+	c.pending.add()
+	defer c.pending.done()
+
+	session, err := c.sessionKey()
+	if err != nil {
+		return err
+	}
+
+	err = fn(session)
+	var apiErr *APIError
+	if session != "" && xerrors.As(err, &apiErr) &&
+		(apiErr.Code == CodeSessionInvalid || apiErr.Code == CodeSessionUnbound) {
+		c.resetSession(session)
+		if session, err = c.sessionKey(); err != nil {
+			return err
+		}
+		err = fn(session)
+	}
+	return err
+}
+
+// send performs a single request without any session handling.
+func (c *Client) send(method, endpoint string, query url.Values, body interface{}, resp interface{}) error {
+	var r io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return xerrors.Errorf("encode %s request: %w", endpoint, err)
+		}
+		r = bytes.NewReader(data)
+	}
+
+	u := strings.TrimSuffix(c.cfg.Post, "/") + endpoint
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(c.ctx, method, u, r)
+	if err != nil {
+		return xerrors.Errorf("build %s request: %w", endpoint, err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	return c.do(endpoint, req, resp)
+}
+
+// do executes req and decodes the mirai response envelope.
+func (c *Client) do(endpoint string, req *http.Request, resp interface{}) (err error) {
+	defer func() {
+		code := strconv.Itoa(CodeSuccess)
+		var apiErr *APIError
+		switch {
+		case xerrors.As(err, &apiErr):
+			code = strconv.Itoa(apiErr.Code)
+		case err != nil:
+			code = "error"
+		}
+		c.metrics.observeCall(endpoint, code)
+	}()
+
+	res, err := c.http.Do(req)
+	if err != nil {
+		return xerrors.Errorf("request %s: %w", endpoint, err)
+	}
+	defer res.Body.Close()
+
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		return xerrors.Errorf("read %s response: %w", endpoint, err)
+	}
+	if res.StatusCode != http.StatusOK {
+		return &APIError{Endpoint: endpoint, Code: res.StatusCode, Msg: strings.TrimSpace(string(data))}
+	}
+
+	var envelope apiResponse
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		return xerrors.Errorf("decode %s response: %w", endpoint, err)
+	}
+	if envelope.Code != CodeSuccess {
+		return &APIError{Endpoint: endpoint, Code: envelope.Code, Msg: envelope.Msg}
+	}
+
+	if resp != nil {
+		if err := json.Unmarshal(data, resp); err != nil {
+			return xerrors.Errorf("decode %s response: %w", endpoint, err)
+		}
+	}
+	return nil
+}
+
+// formFile is a file part of a multipart request.
+type formFile struct {
+	Field    string
+	Name     string
+	MIME     string
+	Contents []byte
+}
+
+// upload calls a multipart endpoint with the given form fields and file.
+func (c *Client) upload(endpoint string, fields map[string]string, file formFile, resp interface{}) error {
+	return c.call(func(session string) error {
+		var buf bytes.Buffer
+		w := multipart.NewWriter(&buf)
+
+		if session != "" {
+			if err := w.WriteField("sessionKey", session); err != nil {
+				return err
+			}
+		}
+		for k, v := range fields {
+			if err := w.WriteField(k, v); err != nil {
+				return err
+			}
+		}
+
+		h := textproto.MIMEHeader{}
+		h.Set("Content-Disposition", fmt.Sprintf(`form-data; name=%s; filename=%s`,
+			strconv.Quote(file.Field), strconv.Quote(file.Name)))
+		h.Set("Content-Type", file.MIME)
+		part, err := w.CreatePart(h)
+		if err != nil {
+			return err
+		}
+		if _, err := part.Write(file.Contents); err != nil {
+			return err
+		}
+		if err := w.Close(); err != nil {
+			return err
+		}
+
+		u := strings.TrimSuffix(c.cfg.Post, "/") + endpoint
+		req, err := http.NewRequestWithContext(c.ctx, http.MethodPost, u, &buf)
+		if err != nil {
+			return xerrors.Errorf("build %s request: %w", endpoint, err)
+		}
+		req.Header.Set("Content-Type", w.FormDataContentType())
+
+		return c.do(endpoint, req, resp)
+	})
+}
@@ -0,0 +1,115 @@
+package koharutest
+
+import (
+	"fmt"
+	"github.com/mafuka/koharu/core"
+	"regexp"
+	"strings"
+)
+
+// sendEndpoints are the mirai endpoints sending messages.
+var sendEndpoints = []string{"/sendGroupMessage", "/sendFriendMessage", "/sendTempMessage"}
+
+// Matcher checks a message chain sent by the bot.
+type Matcher func(chain core.MessageChain) bool
+
+// Any matches every message.
+func Any() Matcher {
+	return func(core.MessageChain) bool { return true }
+}
+
+// Text matches messages whose plain text is s.
+func Text(s string) Matcher {
+	return func(chain core.MessageChain) bool { return chain.PlainText() == s }
+}
+
+// Contains matches messages whose plain text contains s.
+func Contains(s string) Matcher {
+	return func(chain core.MessageChain) bool { return strings.Contains(chain.PlainText(), s) }
+}
+
+// Regexp matches messages whose plain text matches expr.
+func Regexp(expr string) Matcher {
+	re := regexp.MustCompile(expr)
+	return func(chain core.MessageChain) bool { return re.MatchString(chain.PlainText()) }
+}
+
+// ExpectGroupMessage waits for a message sent to group matching m, and fails the test if none comes.
+// Each sent message satisfies a single expectation, so expecting twice needs two messages.
+func (h *Harness) ExpectGroupMessage(group int, m Matcher) Call {
+	h.t.Helper()
+	return h.expectMessage(fmt.Sprintf("a message to group %d", group), func(c Call) bool {
+		return c.Endpoint == "/sendGroupMessage" && c.Int("target") == group && m(c.Chain())
+	})
+}
+
+// ExpectFriendMessage waits for a message sent to friend matching m, and fails the test if none comes.
+func (h *Harness) ExpectFriendMessage(friend int, m Matcher) Call {
+	h.t.Helper()
+	return h.expectMessage(fmt.Sprintf("a message to friend %d", friend), func(c Call) bool {
+		return c.Endpoint == "/sendFriendMessage" && c.Int("target") == friend && m(c.Chain())
+	})
+}
+
+// ExpectTempMessage waits for a message sent to member of group in a temp chat matching m,
+// and fails the test if none comes.
+func (h *Harness) ExpectTempMessage(group, member int, m Matcher) Call {
+	h.t.Helper()
+	return h.expectMessage(fmt.Sprintf("a temp message to %d in group %d", member, group), func(c Call) bool {
+		return c.Endpoint == "/sendTempMessage" && c.Int("group") == group && c.Int("qq") == member && m(c.Chain())
+	})
+}
+
+// ExpectCall waits for a call to endpoint for which match returns true, and fails the test if none comes.
+// A nil match accepts any call to endpoint.
+func (h *Harness) ExpectCall(endpoint string, match func(c Call) bool) Call {
+	h.t.Helper()
+	var call Call
+	h.wait("a call to "+endpoint, func() bool {
+		var ok bool
+		call, ok = h.Mirai.take(func(c Call) bool {
+			return c.Endpoint == endpoint && (match == nil || match(c))
+		})
+		return ok
+	})
+	return call
+}
+
+// ExpectNoMessages fails the test if the bot sent messages not matched by an expectation.
+func (h *Harness) ExpectNoMessages() {
+	h.t.Helper()
+	if calls := h.Mirai.untaken(sendEndpoints...); len(calls) > 0 {
+		h.t.Fatalf("koharutest: unexpected messages:\n%s", describe(calls))
+	}
+}
+
+// expectMessage waits for a send call for which match returns true.
+func (h *Harness) expectMessage(what string, match func(c Call) bool) Call {
+	h.t.Helper()
+	var call Call
+	ok := poll(h.Timeout, func() bool {
+		var ok bool
+		call, ok = h.Mirai.take(match)
+		return ok
+	})
+	if !ok {
+		h.t.Fatalf("koharutest: no %s matched within %s, sent:\n%s", what, h.Timeout, describe(h.Mirai.untaken(sendEndpoints...)))
+	}
+	return call
+}
+
+// describe lists sent messages for failure reports.
+func describe(calls []Call) string {
+	if len(calls) == 0 {
+		return "  (nothing)"
+	}
+	lines := make([]string, len(calls))
+	for i, c := range calls {
+		target := fmt.Sprint(c.Int("target"))
+		if c.Endpoint == "/sendTempMessage" {
+			target = fmt.Sprintf("%d in group %d", c.Int("qq"), c.Int("group"))
+		}
+		lines[i] = fmt.Sprintf("  %s %s: %q", c.Endpoint, target, c.Chain().PlainText())
+	}
+	return strings.Join(lines, "\n")
+}
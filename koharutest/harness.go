@@ -0,0 +1,227 @@
+// Package koharutest runs a koharu Bot against a fake mirai-api-http, entirely offline.
+//
+// A test posts events to the bot's webhook and asserts on the calls it made to mirai:
+//
+//	h := koharutest.New(t)
+//	h.Command(&core.Command{Name: "ping", Handler: func(c *core.Context, args []string) {
+//		c.SendText("pong")
+//	}})
+//	h.GroupMessage(100, 200, core.Text("/ping"))
+//	h.ExpectGroupMessage(100, koharutest.Text("pong"))
+package koharutest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/mafuka/koharu/core"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// BotID is the QQ account of the bot under test.
+const BotID = 10000
+
+// Harness is a started Bot wired to a fake mirai. It is shut down when the test ends.
+type Harness struct {
+	*core.Bot
+	Mirai   *Mirai
+	Timeout time.Duration // How long expectations and posted events are waited for
+
+	t        testing.TB
+	mu       sync.Mutex
+	accepted uint64 // events accepted by the webhook
+	seq      int    // last message ID and timestamp handed out
+}
+
+// Configure is a bot option changing the configuration, e.g. to set admins.
+// Server settings are managed by the harness.
+func Configure(fn func(cfg *core.Config)) core.Option {
+	return func(b *core.Bot) {
+		fn(b.Config)
+	}
+}
+
+// New starts a Bot with the given options against a fresh fake mirai.
+// Data and the audit log are kept in a temporary directory. The global logger is left as the test program set it.
+func New(t testing.TB, options ...core.Option) *Harness {
+	t.Helper()
+	m := NewMirai()
+	dir := t.TempDir()
+
+	cfg := core.DefaultConfig()
+	cfg.Server.Address = "127.0.0.1:0"
+	cfg.Server.Post = m.URL
+	cfg.Server.Secret = "koharutest"
+	cfg.Server.QQ = BotID
+	cfg.Server.Shutdown = 5
+	cfg.Storage.Dir = filepath.Join(dir, "data")
+	cfg.Audit.File = filepath.Join(dir, "audit.jsonl")
+	cfg.Health.Probe = false
+
+	b := core.New(append([]core.Option{core.WithConfig(cfg)}, options...)...)
+	b.Start()
+
+	h := &Harness{Bot: b, Mirai: m, Timeout: 2 * time.Second, t: t, seq: int(time.Now().Unix())}
+	t.Cleanup(func() {
+		if err := b.Close(); err != nil {
+			t.Errorf("koharutest: close bot: %s", err)
+		}
+		m.Close()
+	})
+	return h
+}
+
+// PostJSON posts a raw event to the webhook and waits until the bot has processed it.
+// It returns the HTTP status of the webhook.
+func (h *Harness) PostJSON(raw []byte) int {
+	h.t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/hook", bytes.NewReader(raw))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	h.Engine.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		return rec.Code
+	}
+
+	h.mu.Lock()
+	h.accepted++
+	accepted := h.accepted
+	h.mu.Unlock()
+	h.wait("event to be processed", func() bool {
+		return h.Dispatcher.Stats().Processed >= accepted
+	})
+	return rec.Code
+}
+
+// PostEvent posts e to the webhook as mirai would and waits until the bot has processed it.
+func (h *Harness) PostEvent(e core.Event) {
+	h.t.Helper()
+	raw, err := json.Marshal(e)
+	if err != nil {
+		h.t.Fatalf("koharutest: encode %s: %s", e.EventType(), err)
+	}
+	h.post(raw)
+}
+
+// GroupMessage posts a message sent by member in group, and returns its message ID.
+// The chain is prefixed with a Source unless it has one.
+func (h *Harness) GroupMessage(group, member int, chain core.MessageChain) int {
+	h.t.Helper()
+	id, chain := h.source(chain)
+	h.post(mustJSON(h.t, map[string]interface{}{
+		"type":         "GroupMessage",
+		"sender":       h.member(group, member),
+		"messageChain": chain,
+	}))
+	return id
+}
+
+// FriendMessage posts a message sent by friend, and returns its message ID.
+func (h *Harness) FriendMessage(friend int, chain core.MessageChain) int {
+	h.t.Helper()
+	id, chain := h.source(chain)
+	h.post(mustJSON(h.t, map[string]interface{}{
+		"type": "FriendMessage",
+		"sender": map[string]interface{}{
+			"id":       friend,
+			"nickname": fmt.Sprintf("Friend %d", friend),
+			"remark":   "",
+		},
+		"messageChain": chain,
+	}))
+	return id
+}
+
+// TempMessage posts a message sent by member of group in a temp chat, and returns its message ID.
+func (h *Harness) TempMessage(group, member int, chain core.MessageChain) int {
+	h.t.Helper()
+	id, chain := h.source(chain)
+	h.post(mustJSON(h.t, map[string]interface{}{
+		"type":         "TempMessage",
+		"sender":       h.member(group, member),
+		"messageChain": chain,
+	}))
+	return id
+}
+
+// post posts raw and fails the test unless the webhook accepted it.
+func (h *Harness) post(raw []byte) {
+	h.t.Helper()
+	if code := h.PostJSON(raw); code != http.StatusOK {
+		h.t.Fatalf("koharutest: webhook answered %d to %s", code, raw)
+	}
+}
+
+// source returns the message ID of chain, prefixing it with a new Source if it has none.
+func (h *Harness) source(chain core.MessageChain) (int, core.MessageChain) {
+	if src := chain.Source(); src != nil {
+		return src.ID, chain
+	}
+	h.mu.Lock()
+	h.seq++
+	src := &core.Source{Type: "Source", ID: h.seq, Time: h.seq}
+	h.mu.Unlock()
+	return src.ID, append(core.MessageChain{src}, chain...)
+}
+
+// member builds the sender of a group or temp message. Members listed through Mirai.AddGroup keep their details.
+func (h *Harness) member(group, id int) core.Member {
+	now := int(time.Now().Unix())
+	m := core.Member{
+		ID:                 id,
+		MemberName:         fmt.Sprintf("Member %d", id),
+		Permission:         core.PermissionMember,
+		JoinTimestamp:      now,
+		LastSpeakTimestamp: now,
+		Group:              core.Group{ID: group, Name: fmt.Sprintf("Group %d", group), Permission: core.PermissionMember},
+	}
+
+	h.Mirai.mu.Lock()
+	defer h.Mirai.mu.Unlock()
+	for _, g := range h.Mirai.groups {
+		if g.ID == group {
+			m.Group = g
+		}
+	}
+	for _, known := range h.Mirai.members[group] {
+		if known.ID == id {
+			known.Group = m.Group
+			m = known
+		}
+	}
+	return m
+}
+
+// wait polls cond until it holds, failing the test after Timeout.
+func (h *Harness) wait(what string, cond func() bool) {
+	h.t.Helper()
+	if !poll(h.Timeout, cond) {
+		h.t.Fatalf("koharutest: timed out after %s waiting for %s", h.Timeout, what)
+	}
+}
+
+// poll reports whether cond holds within timeout.
+func poll(timeout time.Duration, cond func() bool) bool {
+	deadline := time.Now().Add(timeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	return true
+}
+
+func mustJSON(t testing.TB, v interface{}) []byte {
+	t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatalf("koharutest: encode event: %s", err)
+	}
+	return data
+}
@@ -0,0 +1,150 @@
+package koharutest_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/mafuka/koharu/core"
+	"github.com/mafuka/koharu/koharutest"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func ping() *core.Command {
+	return &core.Command{
+		Name: "ping",
+		Handler: func(c *core.Context, args []string) {
+			c.SendText("pong %d", len(args))
+		},
+	}
+}
+
+func TestGroupCommand(t *testing.T) {
+	h := koharutest.New(t)
+	h.Command(ping())
+
+	h.GroupMessage(100, 200, core.Text("/ping a b"))
+	call := h.ExpectGroupMessage(100, koharutest.Text("pong 2"))
+	if call.Body["sessionKey"] != koharutest.Session {
+		t.Errorf("sessionKey = %v, want %s", call.Body["sessionKey"], koharutest.Session)
+	}
+	h.ExpectNoMessages()
+
+	if calls := h.Mirai.Calls("/verify", "/bind"); len(calls) != 2 {
+		t.Errorf("got %d session calls, want verify and bind", len(calls))
+	}
+}
+
+func TestFriendAndTempMessages(t *testing.T) {
+	h := koharutest.New(t)
+	h.Command(ping())
+
+	h.FriendMessage(300, core.Text("/ping"))
+	h.TempMessage(100, 200, core.Text("/ping x"))
+	h.ExpectTempMessage(100, 200, koharutest.Contains("1"))
+	h.ExpectFriendMessage(300, koharutest.Regexp(`^pong 0$`))
+	h.ExpectNoMessages()
+}
+
+func TestEachMessageMatchesOnce(t *testing.T) {
+	h := koharutest.New(t)
+	h.Command(ping())
+
+	h.GroupMessage(100, 200, core.Text("/ping"))
+	h.GroupMessage(100, 200, core.Text("/ping"))
+	h.ExpectGroupMessage(100, koharutest.Any())
+	h.ExpectGroupMessage(100, koharutest.Any())
+	h.ExpectNoMessages()
+}
+
+func TestScriptedResponses(t *testing.T) {
+	h := koharutest.New(t)
+	errs := make(chan error, 2)
+	h.Command(&core.Command{
+		Name: "say",
+		Handler: func(c *core.Context, args []string) {
+			_, err := c.SendText("hi")
+			errs <- err
+		},
+	})
+	h.Mirai.RespondOnce("/sendGroupMessage", koharutest.Error(core.CodeBotMuted, "muted"))
+
+	h.GroupMessage(100, 200, core.Text("/say"))
+	h.GroupMessage(100, 200, core.Text("/say"))
+	if err := <-errs; err == nil {
+		t.Error("first send succeeded, want the scripted error")
+	}
+	if err := <-errs; err != nil {
+		t.Errorf("second send failed: %s", err)
+	}
+}
+
+func TestInlineAwait(t *testing.T) {
+	h := koharutest.New(t)
+	ready := make(chan struct{})
+	h.Command(&core.Command{
+		Name: "quiz",
+		Handler: func(c *core.Context, args []string) {
+			close(ready)
+			next, err := c.Await(nil, nil, time.Second)
+			if err != nil {
+				c.SendText("failed: %s", err)
+				return
+			}
+			c.SendText("answer %s", next.Chain().PlainText())
+		},
+	})
+
+	// The answer is posted while /quiz holds up the worker of the chat, so the harness can't wait for it.
+	answer, _ := json.Marshal(map[string]interface{}{
+		"type":         "GroupMessage",
+		"sender":       core.Member{ID: 200, Group: core.Group{ID: 100}},
+		"messageChain": append(core.MessageChain{&core.Source{Type: "Source", ID: 1, Time: 1}}, core.Text("42")...),
+	})
+	go func() {
+		<-ready
+		time.Sleep(50 * time.Millisecond)
+		req := httptest.NewRequest(http.MethodPost, "/hook", bytes.NewReader(answer))
+		req.Header.Set("Content-Type", "application/json")
+		h.Engine.ServeHTTP(httptest.NewRecorder(), req)
+	}()
+
+	h.GroupMessage(100, 200, core.Text("/quiz"))
+	h.ExpectGroupMessage(100, koharutest.Text("answer 42"))
+	h.ExpectNoMessages()
+}
+
+func TestAdminMuteCommand(t *testing.T) {
+	h := koharutest.New(t, koharutest.Configure(func(cfg *core.Config) {
+		cfg.Admin = []int{200}
+	}))
+	h.Mirai.AddGroup(core.Group{ID: 100, Name: "test", Permission: core.PermissionAdministrator},
+		core.Member{ID: 300, Permission: core.PermissionMember})
+	h.Command(&core.Command{
+		Name:  "mute",
+		Admin: true,
+		Handler: func(c *core.Context, args []string) {
+			if err := c.Mute(100, 300, time.Minute); err != nil {
+				c.SendText("failed: %s", err)
+			}
+		},
+	})
+
+	h.GroupMessage(100, 200, core.Text("/mute"))
+	h.ExpectCall("/mute", func(c koharutest.Call) bool {
+		return c.Int("target") == 100 && c.Int("memberId") == 300 && c.Int("time") == 60
+	})
+	h.ExpectNoMessages()
+}
+
+func TestPostJSON(t *testing.T) {
+	h := koharutest.New(t)
+	if code := h.PostJSON([]byte(`{"type":"NoSuchEvent"}`)); code != http.StatusBadRequest {
+		t.Errorf("unknown event answered %d, want %d", code, http.StatusBadRequest)
+	}
+	h.PostEvent(&core.BotOfflineEventForce{Type: "BotOfflineEventForce", QQ: koharutest.BotID})
+	if state, _ := h.Health.State(); state != core.StateOffline {
+		t.Errorf("state = %s, want %s", state, core.StateOffline)
+	}
+}
@@ -0,0 +1,260 @@
+package koharutest
+
+import (
+	"encoding/json"
+	"github.com/mafuka/koharu/core"
+	"io"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// Session is the session key handed out by the fake mirai.
+const Session = "koharutest"
+
+// Call is a request received by the fake mirai.
+type Call struct {
+	Method   string
+	Endpoint string                 // e.g. /sendGroupMessage
+	Query    url.Values             // Query of GET requests
+	Body     map[string]interface{} // JSON body, or the form fields of uploads
+}
+
+// Int returns the number field key of the call, or 0.
+func (c Call) Int(key string) int {
+	switch v := c.Body[key].(type) {
+	case float64:
+		return int(v)
+	case string:
+		var n int
+		_ = json.Unmarshal([]byte(v), &n)
+		return n
+	}
+	return 0
+}
+
+// Chain returns the message chain sent by the call, if any.
+func (c Call) Chain() core.MessageChain {
+	data, err := json.Marshal(c.Body["messageChain"])
+	if err != nil {
+		return nil
+	}
+	var chain core.MessageChain
+	_ = json.Unmarshal(data, &chain)
+	return chain
+}
+
+// Error builds the response of a failed mirai call.
+func Error(code int, msg string) map[string]interface{} {
+	return map[string]interface{}{"code": code, "msg": msg}
+}
+
+// Mirai is a fake mirai-api-http HTTP adapter. It records every call and answers
+// with scripted responses, or with a success by default:
+//   - /verify and /bind open the Session, other calls are rejected without it
+//   - /groupList, /friendList and /memberList list the contacts added with AddGroup and AddFriend
+//   - send endpoints return increasing message IDs
+type Mirai struct {
+	*httptest.Server
+
+	mu        sync.Mutex
+	calls     []Call
+	taken     map[int]bool // calls matched by an expectation
+	responses map[string]interface{}
+	once      map[string][]interface{}
+	groups    []core.Group
+	members   map[int][]core.Member
+	friends   []core.Friend
+	messageID int
+}
+
+// NewMirai starts a fake mirai. Close it when done.
+func NewMirai() *Mirai {
+	m := &Mirai{
+		responses: make(map[string]interface{}),
+		once:      make(map[string][]interface{}),
+		taken:     make(map[int]bool),
+		members:   make(map[int][]core.Member),
+	}
+	m.Server = httptest.NewServer(http.HandlerFunc(m.serve))
+	return m
+}
+
+// Respond answers every later call to endpoint with resp, encoded as JSON.
+func (m *Mirai) Respond(endpoint string, resp interface{}) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.responses[endpoint] = resp
+}
+
+// RespondOnce answers the next call to endpoint with resp, before any response set with Respond.
+// Responses given for the same endpoint are used in order.
+func (m *Mirai) RespondOnce(endpoint string, resp interface{}) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.once[endpoint] = append(m.once[endpoint], resp)
+}
+
+// AddGroup adds a group the bot is in, with its members.
+func (m *Mirai) AddGroup(g core.Group, members ...core.Member) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.groups = append(m.groups, g)
+	for _, member := range members {
+		member.Group = g
+		m.members[g.ID] = append(m.members[g.ID], member)
+	}
+}
+
+// AddFriend adds a friend of the bot.
+func (m *Mirai) AddFriend(f core.Friend) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.friends = append(m.friends, f)
+}
+
+// Calls returns the calls received so far, optionally only those to the given endpoints.
+func (m *Mirai) Calls(endpoints ...string) []Call {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var calls []Call
+	for _, c := range m.calls {
+		if len(endpoints) == 0 || contains(endpoints, c.Endpoint) {
+			calls = append(calls, c)
+		}
+	}
+	return calls
+}
+
+// Reset forgets the calls received so far.
+func (m *Mirai) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.calls = nil
+	m.taken = make(map[int]bool)
+}
+
+// take returns the first call not taken yet that matches and marks it as taken.
+func (m *Mirai) take(match func(Call) bool) (Call, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, c := range m.calls {
+		if !m.taken[i] && match(c) {
+			m.taken[i] = true
+			return c, true
+		}
+	}
+	return Call{}, false
+}
+
+// untaken returns the calls to endpoints not taken yet.
+func (m *Mirai) untaken(endpoints ...string) []Call {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var calls []Call
+	for i, c := range m.calls {
+		if !m.taken[i] && contains(endpoints, c.Endpoint) {
+			calls = append(calls, c)
+		}
+	}
+	return calls
+}
+
+func (m *Mirai) serve(w http.ResponseWriter, r *http.Request) {
+	call, err := readCall(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	m.mu.Lock()
+	m.calls = append(m.calls, call)
+	resp := m.respond(call)
+	m.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// respond returns the response to call. m.mu must be held.
+func (m *Mirai) respond(call Call) interface{} {
+	if q := m.once[call.Endpoint]; len(q) > 0 {
+		m.once[call.Endpoint] = q[1:]
+		return q[0]
+	}
+	if resp, ok := m.responses[call.Endpoint]; ok {
+		return resp
+	}
+
+	switch call.Endpoint {
+	case "/about":
+		return map[string]interface{}{"code": 0, "msg": "", "data": map[string]string{"version": "2.10.0"}}
+	case "/verify":
+		return map[string]interface{}{"code": 0, "session": Session}
+	}
+	key := call.Query.Get("sessionKey")
+	if s, ok := call.Body["sessionKey"].(string); ok {
+		key = s
+	}
+	if key != Session {
+		return Error(core.CodeSessionInvalid, "session invalid")
+	}
+
+	switch call.Endpoint {
+	case "/groupList":
+		return list(m.groups)
+	case "/friendList":
+		return list(m.friends)
+	case "/memberList":
+		var group int
+		_ = json.Unmarshal([]byte(call.Query.Get("target")), &group)
+		return list(m.members[group])
+	}
+	m.messageID++
+	return map[string]interface{}{"code": 0, "msg": "success", "messageId": m.messageID}
+}
+
+// list builds the response of a list endpoint.
+func list[T any](data []T) map[string]interface{} {
+	if data == nil {
+		data = []T{}
+	}
+	return map[string]interface{}{"code": 0, "msg": "", "data": data}
+}
+
+// readCall decodes a request to the fake mirai.
+func readCall(r *http.Request) (Call, error) {
+	call := Call{Method: r.Method, Endpoint: r.URL.Path, Query: r.URL.Query(), Body: map[string]interface{}{}}
+	if r.Method != http.MethodPost {
+		return call, nil
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType == "multipart/form-data" {
+		if err := r.ParseMultipartForm(32 << 20); err != nil {
+			return call, err
+		}
+		for k, v := range r.MultipartForm.Value {
+			call.Body[k] = strings.Join(v, ",")
+		}
+		return call, nil
+	}
+
+	data, err := io.ReadAll(r.Body)
+	if err != nil || len(data) == 0 {
+		return call, err
+	}
+	return call, json.Unmarshal(data, &call.Body)
+}
+
+func contains(ss []string, s string) bool {
+	for _, v := range ss {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}